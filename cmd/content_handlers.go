@@ -1,50 +1,110 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"html/template"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	d2s "github.com/kevineaton/d2tosite/parser"
 )
 
 // handleMD takes a string path to an MD file and then reads it and hands it off to the library
-func handleMD(inputFile, prefix string) (*d2s.LeafData, error) {
+func handleMD(inputFile, prefix string, options *d2s.MarkdownOptions) (*d2s.LeafData, error) {
 	// process the md
 	content, err := os.ReadFile(inputFile)
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := d2s.ParseMD(content, prefix)
+	data, err := d2s.ParseMD(content, prefix, options)
 	if err != nil {
-		return data, err
+		// the parser doesn't know which file it was given, so make sure the error says
+		return data, fmt.Errorf("%s: %w", inputFile, err)
 	}
 
 	if data.Title == "" {
-		data.Title = strings.TrimRight(filepath.Base(inputFile), filepath.Ext(inputFile))
+		data.Title = strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
 	}
 	data.FileName = prefix + strings.Replace(filepath.Base(inputFile), ".md", ".html", -1)
 	return data, err
 }
 
-// handleD2 takes a string for an input file and processes it
-func handleD2(inputFile string, outputFile string, options *d2s.ParseOptions) error {
+// handleD2 takes a string for an input file and processes it, returning what the compiler found. If
+// there is a dark theme, the diagram is also written with it next to the output, at darkPath.
+func handleD2(inputFile string, outputFile string, options *d2s.ParseOptions, darkTheme int64) (*d2s.DiagramData, error) {
 	content, err := os.ReadFile(inputFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	out, err := d2s.ParseD2(content, options)
+	// a directive in the file wins over everything else
+	settings, err := parseD2Directives(content)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !settings.isEmpty() {
+		fileOptions := d2s.ParseOptions{}
+		if options != nil {
+			fileOptions = *options
+		}
+		settings.apply(&fileOptions)
+		options = &fileOptions
+	}
+
+	if options == nil {
+		options = &d2s.ParseOptions{D2Theme: 1}
+	}
+	themes := []int64{options.D2Theme}
+	if darkTheme != 0 {
+		themes = append(themes, darkTheme)
+	}
+	rendered, data, err := d2s.CompileD2Themes(content, options, themes...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(filepath.Join(outputFile), rendered[0], 0600)
+	if err != nil {
+		return nil, err
 	}
+	if len(rendered) > 1 {
+		err = os.WriteFile(darkPath(outputFile), rendered[1], 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
 
-	err = os.WriteFile(filepath.Join(outputFile), out, 0600)
+// handleD2JSON writes the compiled model of a diagram next to its SVG so other tools can read it
+func handleD2JSON(outputFile string, data *d2s.DiagramData) error {
+	if data.Model == nil {
+		return fmt.Errorf("the diagram has no compiled model")
+	}
+	encoded, err := json.MarshalIndent(data.Model, "", "  ")
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.WriteFile(jsonPath(outputFile), encoded, 0600)
+}
+
+// jsonPath is where the compiled model of a diagram is written, such as flows/login.d2.json
+func jsonPath(svgPath string) string {
+	return strings.TrimSuffix(svgPath, ".svg") + ".d2.json"
+}
+
+// diagramPagePath is the site path of a diagram's own page, such as /diagrams/flows/login.html
+func diagramPagePath(svgPath string) string {
+	return "/diagrams" + strings.TrimSuffix(svgPath, ".svg") + ".html"
+}
+
+// darkPath is where the dark theme of a diagram is written, such as flows/login.dark.svg
+func darkPath(svgPath string) string {
+	return strings.TrimSuffix(svgPath, ".svg") + ".dark.svg"
 }
 
 func handleOther(inputFile string, outputFile string) error {
@@ -55,3 +115,142 @@ func handleOther(inputFile string, outputFile string) error {
 	err = os.WriteFile(outputFile, b, os.ModePerm)
 	return err
 }
+
+// embedRegex finds the diagram images that the parser placed in the content, along with the paragraph
+// around them if there is one
+var embedRegex = regexp.MustCompile(`(<p>)?<img src='([^']+\.svg)' class='diagram-svg' alt='diagram'((?: data-embed='(?:inline|img)')?)( data-source='hidden')? />(</p>)?`)
+
+// embedDiagrams finishes the diagram embeds in the content once the diagrams are compiled: inlining,
+// dark themes, links to the diagram pages, sizes, wide diagrams, and the sources, with any text in the
+// page's language
+func embedDiagrams(content template.HTML, diagrams map[string]d2s.DiagramData, text map[string]string, options *CommandOptions) template.HTML {
+	inliner := d2s.NewSVGInliner()
+	sources := []string{}
+	output := embedRegex.ReplaceAllStringFunc(string(content), func(embed string) string {
+		parts := embedRegex.FindStringSubmatch(embed)
+		diagram := diagrams[parts[2]]
+		size := diagram.Size
+		sized := size.Width > 0 && size.Height > 0
+		image := func(src string, class string) string {
+			markup := fmt.Sprintf("<img src='%s' class='%s' alt='diagram'%s />", src, class, parts[3])
+			if sized {
+				markup = strings.TrimSuffix(markup, " />") + fmt.Sprintf(" width='%d' height='%d' style='aspect-ratio: %d / %d;' />", size.Width, size.Height, size.Width, size.Height)
+			}
+			return markup
+		}
+		markup := image(parts[2], "diagram-svg")
+		inlined := false
+		mode := strings.TrimSuffix(strings.TrimPrefix(parts[3], " data-embed='"), "'")
+		if mode == "inline" || (mode == "" && options.InlineDiagrams) {
+			svg, err := os.ReadFile(filepath.Join(options.OutputDirectory, parts[2]))
+			if err == nil {
+				markup = string(inliner.Inline(svg))
+				inlined = true
+			}
+		}
+		// both themes are embedded, and the page's stylesheet shows the dark one when the page is in dark mode
+		if diagram.DarkPath != "" {
+			if !inlined {
+				markup = image(parts[2], "diagram-svg diagram-theme-light") + image(diagram.DarkPath, "diagram-svg diagram-theme-dark")
+			} else if dark, err := os.ReadFile(filepath.Join(options.OutputDirectory, diagram.DarkPath)); err == nil {
+				markup = fmt.Sprintf("<span class='diagram-theme-light'>%s</span><span class='diagram-theme-dark'>%s</span>", markup, inliner.Inline(dark))
+			}
+		}
+		// an inlined diagram may have links of its own, which can't be inside of another link
+		if diagram.PagePath != "" {
+			if inlined {
+				markup = fmt.Sprintf("%s<a href='%s' class='diagram-view-link'>%s</a>", markup, diagram.PagePath, template.HTMLEscapeString(text["view_diagram"]))
+			} else {
+				markup = fmt.Sprintf("<a href='%s' class='diagram-page-link'>%s</a>", diagram.PagePath, markup)
+			}
+		}
+		if sized && options.WideDiagramWidth > 0 && size.Width > options.WideDiagramWidth {
+			// spans are used since the embed is usually inside of a paragraph
+			switch options.WideDiagrams {
+			case wideDiagramsScroll:
+				markup = fmt.Sprintf("<span class='diagram-wide diagram-scroll'>%s</span>", markup)
+			case wideDiagramsExpand:
+				markup = fmt.Sprintf("<span class='diagram-wide diagram-expand'>%s<a href='%s' class='diagram-expand-link' target='_blank'>%s</a></span>", markup, parts[2], template.HTMLEscapeString(text["open_full_diagram"]))
+			}
+		}
+		markup = parts[1] + markup + parts[5]
+		if diagram.Code == "" || parts[4] != "" {
+			return markup
+		}
+		source := fmt.Sprintf("<details class='diagram-source'><summary>%s</summary>"+
+			"<button type='button' class='btn btn-sm btn-outline-secondary diagram-source-copy'>%s</button>%s</details>",
+			template.HTMLEscapeString(text["view_source"]), template.HTMLEscapeString(text["copy"]), diagram.Code)
+		// the source is a block, so it can't be in the paragraph; when the diagram doesn't end the
+		// paragraph, it is moved after it below
+		if parts[5] != "" {
+			return markup + source
+		}
+		sources = append(sources, source)
+		return markup + sourcePlaceholder(len(sources)-1)
+	})
+	// the last sources are moved first, so the sources after the same paragraph keep their order
+	for i := len(sources) - 1; i >= 0; i-- {
+		placeholder := sourcePlaceholder(i)
+		start := strings.Index(output, placeholder)
+		output = output[:start] + output[start+len(placeholder):]
+		// outside of a paragraph, such as in a list item or a table cell, the source can follow the diagram
+		end := paragraphEnd(output, start)
+		if end == -1 {
+			end = start
+		}
+		output = output[:end] + sources[i] + output[end:]
+	}
+	return template.HTML(output)
+}
+
+// sourcePlaceholder marks where the source of a diagram in the middle of a paragraph was, until it
+// is moved after the paragraph
+func sourcePlaceholder(index int) string {
+	return fmt.Sprintf("d2tositesource%dx", index)
+}
+
+// tagRegex finds the opening and closing tags in the content, and whether they close themselves
+var tagRegex = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)\b[^>]*?(/?)>`)
+
+// voidElements are the elements that don't have a closing tag
+var voidElements = map[string]bool{
+	"area": true, "br": true, "col": true, "embed": true, "hr": true, "img": true, "input": true,
+	"link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// paragraphEnd finds the end of the paragraph that the content at start is directly in, after its
+// closing tag, or -1 if the element it is in is something else
+func paragraphEnd(content string, start int) int {
+	depth := 0
+	for offset := start; ; {
+		match := tagRegex.FindStringSubmatchIndex(content[offset:])
+		if match == nil {
+			return -1
+		}
+		name := strings.ToLower(content[offset+match[4] : offset+match[5]])
+		switch {
+		case match[3] > match[2]:
+			if depth == 0 {
+				if name == "p" {
+					return offset + match[1]
+				}
+				return -1
+			}
+			depth--
+		case match[7] == match[6] && !voidElements[name]:
+			depth++
+		}
+		offset += match[1]
+	}
+}
+
+// searchableLinks copies the pages with any rendered math swapped for its TeX, since the pages are
+// added to the search index of every page and the SVG would make it much larger without being searchable
+func searchableLinks(links []d2s.LeafData) []d2s.LeafData {
+	searchable := make([]d2s.LeafData, len(links))
+	for i := range links {
+		searchable[i] = links[i]
+		searchable[i].Content = template.HTML(d2s.MathRegex.ReplaceAllString(string(links[i].Content), "$1"))
+	}
+	return searchable
+}
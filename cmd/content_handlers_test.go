@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"html/template"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/kevineaton/d2tosite/parser"
@@ -26,7 +28,7 @@ func TestD2Handler(t *testing.T) {
 	file.Close()
 
 	// process it
-	err = handleD2(inputFileName, outputFileName, &parser.ParseOptions{})
+	_, err = handleD2(inputFileName, outputFileName, &parser.ParseOptions{}, 0)
 	if err != nil {
 		t.Fatalf("tried to handle test file but could not: %v", err)
 	}
@@ -52,17 +54,250 @@ func TestMDHandler(t *testing.T) {
 	file.Close()
 
 	// process it
-	data, err := handleMD(inputFileName, "")
+	data, err := handleMD(inputFileName, "", nil)
 	if err != nil {
 		t.Fatalf("tried to handle test file but could not: %v", err)
 	}
 	if data.Title != "Heading" {
 		t.Errorf("expected title of 'Heading' but found '%s'", data.Title)
 	}
-	if data.Content != "<h1>Heading</h1>\n<p>Hi!</p>\n" {
-		t.Errorf("expected content of '<h1>Heading</h1>\n<p>Hi!</p>\n' but found '%s'", data.Content)
+	if data.Content != "<h1 id=\"heading\">Heading</h1>\n<p>Hi!</p>\n" {
+		t.Errorf("expected content of '<h1 id=\"heading\">Heading</h1>\n<p>Hi!</p>\n' but found '%s'", data.Content)
 	}
 
 	os.Remove(inputFileName)
 	os.Remove(outputFileName)
+
+	// errors in the front matter should name the file
+	file, err = os.Create(inputFileName)
+	if err != nil {
+		t.Fatalf("tried to create test file but could not: %v", err)
+	}
+	defer file.Close()
+	_, err = file.Write([]byte("---\nweight: heavy\n---\n# Heading\n"))
+	if err != nil {
+		t.Fatalf("tried to write test file but could not: %v", err)
+	}
+	file.Close()
+	_, err = handleMD(inputFileName, "", nil)
+	if err == nil || !strings.Contains(err.Error(), inputFileName) || !strings.Contains(err.Error(), "'weight'") {
+		t.Errorf("expected the error to name the file and key but found: %v", err)
+	}
+	os.Remove(inputFileName)
+}
+
+func TestInlineDiagrams(t *testing.T) {
+	r := rand.Int63()
+	testDir := fmt.Sprintf("./test_data/inline_%d", r)
+	err := os.MkdirAll(testDir, os.ModePerm)
+	if err != nil {
+		t.Fatalf("could not create filesystem: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	_, err = handleD2("./test_data/src/d2flow.d2", testDir+"/d2flow.svg", &parser.ParseOptions{}, 0)
+	if err != nil {
+		t.Fatalf("tried to handle test file but could not: %v", err)
+	}
+
+	content := template.HTML("<p><img src='/d2flow.svg' class='diagram-svg' alt='diagram' /></p>" +
+		"<p><img src='/d2flow.svg' class='diagram-svg' alt='diagram' data-embed='inline' /></p>" +
+		"<p><img src='/missing.svg' class='diagram-svg' alt='diagram' data-embed='inline' /></p>")
+
+	// by default, only the embed that asks for it is inlined
+	options := &CommandOptions{OutputDirectory: testDir}
+	output := string(embedDiagrams(content, nil, nil, options))
+	if strings.Count(output, "<svg") != 1 {
+		t.Errorf("expected one inlined diagram but found %d", strings.Count(output, "<svg"))
+	}
+	if !strings.Contains(output, "<img src='/d2flow.svg'") || !strings.Contains(output, "<img src='/missing.svg'") {
+		t.Errorf("expected the other embeds to remain images")
+	}
+
+	// site wide, every embed that can be found is inlined
+	options.InlineDiagrams = true
+	output = string(embedDiagrams(content, nil, nil, options))
+	if strings.Count(output, "<svg") != 2 {
+		t.Errorf("expected two inlined diagrams but found %d", strings.Count(output, "<svg"))
+	}
+	if !strings.Contains(output, `id="d2-svg-1"`) || !strings.Contains(output, `id="d2-svg-2"`) {
+		t.Errorf("expected each diagram to have its own namespace")
+	}
+
+	// the default page template styles the inlined diagrams, not just the test site
+	if !strings.Contains(pageTemplateEmbedString, "svg.diagram-inline") {
+		t.Errorf("expected the page template to style the inlined diagrams")
+	}
+}
+
+func TestEmbedDiagramSizes(t *testing.T) {
+	sizes := map[string]parser.DiagramData{
+		"/small.svg": {Size: parser.DiagramSize{Width: 400, Height: 300}},
+		"/wide.svg":  {Size: parser.DiagramSize{Width: 2400, Height: 600}},
+	}
+	content := template.HTML("<p><img src='/small.svg' class='diagram-svg' alt='diagram' /></p>" +
+		"<p><img src='/wide.svg' class='diagram-svg' alt='diagram' /></p>" +
+		"<p><img src='/unknown.svg' class='diagram-svg' alt='diagram' /></p>")
+
+	options := &CommandOptions{WideDiagramWidth: 1000, WideDiagrams: wideDiagramsScroll}
+	output := string(embedDiagrams(content, sizes, nil, options))
+	for _, expected := range []string{
+		"<p><img src='/small.svg' class='diagram-svg' alt='diagram' width='400' height='300' style='aspect-ratio: 400 / 300;' /></p>",
+		"<p><span class='diagram-wide diagram-scroll'><img src='/wide.svg' class='diagram-svg' alt='diagram' width='2400' height='600' style='aspect-ratio: 2400 / 600;' /></span></p>",
+		"<p><img src='/unknown.svg' class='diagram-svg' alt='diagram' /></p>",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected the content to contain %s but found %s", expected, output)
+		}
+	}
+
+	// the wrappers around the image, such as the link to its page, can't stop it scrolling
+	if !strings.Contains(pageTemplateEmbedString, ".diagram-scroll .diagram-svg {") {
+		t.Errorf("expected the page template to keep every diagram in the scroll wrapper at full size")
+	}
+
+	options.WideDiagrams = wideDiagramsExpand
+	text, _ := loadStrings(&CommandOptions{}, "en")
+	output = string(embedDiagrams(content, sizes, text, options))
+	if !strings.Contains(output, "<a href='/wide.svg' class='diagram-expand-link' target='_blank'>Open the full size diagram</a>") || strings.Contains(output, "diagram-scroll") {
+		t.Errorf("expected the wide diagram to link to the full size diagram but found %s", output)
+	}
+
+	options.WideDiagrams = wideDiagramsNone
+	output = string(embedDiagrams(content, sizes, nil, options))
+	if strings.Contains(output, "diagram-wide") || !strings.Contains(output, "width='2400'") {
+		t.Errorf("expected the wide diagram to only be sized but found %s", output)
+	}
+}
+
+func TestEmbedDiagramDarkTheme(t *testing.T) {
+	testDir := t.TempDir()
+	for name, svg := range map[string]string{
+		"flow.svg":      "<svg><rect fill='white' /></svg>",
+		"flow.dark.svg": "<svg><rect fill='black' /></svg>",
+	} {
+		err := os.WriteFile(testDir+"/"+name, []byte(svg), 0600)
+		if err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+	}
+	diagrams := map[string]parser.DiagramData{
+		"/flow.svg": {Path: "/flow.svg", DarkPath: "/flow.dark.svg"},
+	}
+	content := template.HTML("<p><img src='/flow.svg' class='diagram-svg' alt='diagram' /></p>")
+	options := &CommandOptions{OutputDirectory: testDir}
+
+	output := string(embedDiagrams(content, diagrams, nil, options))
+	expected := "<p><img src='/flow.svg' class='diagram-svg diagram-theme-light' alt='diagram' /><img src='/flow.dark.svg' class='diagram-svg diagram-theme-dark' alt='diagram' /></p>"
+	if output != expected {
+		t.Errorf("expected the image to switch to the dark theme\n%s\nbut found\n%s", expected, output)
+	}
+
+	options.InlineDiagrams = true
+	output = string(embedDiagrams(content, diagrams, nil, options))
+	for _, expected := range []string{"<span class='diagram-theme-light'><svg", "fill='white'", "<span class='diagram-theme-dark'><svg", "fill='black'"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected the inlined diagram to contain %s but found %s", expected, output)
+		}
+	}
+}
+
+func TestEmbedDiagramPageLinks(t *testing.T) {
+	testDir := t.TempDir()
+	err := os.WriteFile(testDir+"/flow.svg", []byte("<svg><a href='https://example.com'><rect /></a></svg>"), 0600)
+	if err != nil {
+		t.Fatalf("could not write the diagram: %v", err)
+	}
+	diagrams := map[string]parser.DiagramData{
+		"/flow.svg": {Path: "/flow.svg", PagePath: "/diagrams/flow.html"},
+	}
+	content := template.HTML("<p><img src='/flow.svg' class='diagram-svg' alt='diagram' /></p>")
+	options := &CommandOptions{OutputDirectory: testDir}
+
+	output := string(embedDiagrams(content, diagrams, nil, options))
+	expected := "<p><a href='/diagrams/flow.html' class='diagram-page-link'><img src='/flow.svg' class='diagram-svg' alt='diagram' /></a></p>"
+	if output != expected {
+		t.Errorf("expected the image to link to the diagram's page\n%s\nbut found\n%s", expected, output)
+	}
+
+	// the inlined diagram keeps its own links, so the page is linked after it
+	options.InlineDiagrams = true
+	text, _ := loadStrings(&CommandOptions{}, "en")
+	output = string(embedDiagrams(content, diagrams, text, options))
+	if strings.Contains(output, "class='diagram-page-link'") || !strings.Contains(output, "</svg><a href='/diagrams/flow.html' class='diagram-view-link'>View the diagram</a>") {
+		t.Errorf("expected the inlined diagram to be followed by the link to its page: %s", output)
+	}
+}
+
+func TestEmbedDiagramSource(t *testing.T) {
+	diagrams := map[string]parser.DiagramData{
+		"/flow.svg": {Path: "/flow.svg", Code: template.HTML("<pre>a -&gt; b</pre>")},
+	}
+	options := &CommandOptions{OutputDirectory: t.TempDir()}
+	text, _ := loadStrings(&CommandOptions{}, "en")
+
+	content := template.HTML("<p><img src='/flow.svg' class='diagram-svg' alt='diagram' /></p>")
+	output := string(embedDiagrams(content, diagrams, text, options))
+	expected := "<p><img src='/flow.svg' class='diagram-svg' alt='diagram' /></p><details class='diagram-source'><summary>View source</summary>" +
+		"<button type='button' class='btn btn-sm btn-outline-secondary diagram-source-copy'>Copy</button><pre>a -&gt; b</pre></details>"
+	if output != expected {
+		t.Errorf("expected the source to follow the paragraph\n%s\nbut found\n%s", expected, output)
+	}
+
+	// in the middle of a paragraph, the source waits for the paragraph to end
+	content = template.HTML("<p>Before <img src='/flow.svg' class='diagram-svg' alt='diagram' /> after</p><p>Next</p>")
+	output = string(embedDiagrams(content, diagrams, text, options))
+	expected = "<p>Before <img src='/flow.svg' class='diagram-svg' alt='diagram' /> after</p><details class='diagram-source'>"
+	if !strings.HasPrefix(output, expected) || !strings.HasSuffix(output, "</details><p>Next</p>") {
+		t.Errorf("expected the source to follow the paragraph\n%s\nbut found\n%s", expected, output)
+	}
+
+	// each source follows the paragraph in the order the diagrams are in
+	diagrams["/other.svg"] = parser.DiagramData{Path: "/other.svg", Code: template.HTML("<pre>c -&gt; d</pre>")}
+	content = template.HTML("<p>One <img src='/flow.svg' class='diagram-svg' alt='diagram' /> <em>two</em><br /> <img src='/other.svg' class='diagram-svg' alt='diagram' /> three</p>")
+	output = string(embedDiagrams(content, diagrams, text, options))
+	first, second := strings.Index(output, "a -&gt; b"), strings.Index(output, "c -&gt; d")
+	if !strings.HasPrefix(output, "<p>One <img src='/flow.svg' class='diagram-svg' alt='diagram' /> <em>two</em><br /> <img src='/other.svg' class='diagram-svg' alt='diagram' /> three</p><details") || first == -1 || second < first {
+		t.Errorf("expected the sources to follow the paragraph in order but found\n%s", output)
+	}
+
+	// a diagram in a list item isn't in a paragraph, so its source follows it in the item
+	content = template.HTML("<ul>\n<li>item <img src='/flow.svg' class='diagram-svg' alt='diagram' /></li>\n</ul>\n<h2>Later</h2>\n<p>Far away paragraph.</p>")
+	output = string(embedDiagrams(content, diagrams, text, options))
+	if !strings.Contains(output, "<li>item <img src='/flow.svg' class='diagram-svg' alt='diagram' /><details class='diagram-source'>") ||
+		!strings.Contains(output, "</details></li>") || !strings.HasSuffix(output, "<p>Far away paragraph.</p>") {
+		t.Errorf("expected the source to stay in the list item but found\n%s", output)
+	}
+	content = template.HTML("<table><tr><td><img src='/flow.svg' class='diagram-svg' alt='diagram' /> <code>flow</code></td></tr></table><p>After</p>")
+	output = string(embedDiagrams(content, diagrams, text, options))
+	if !strings.Contains(output, "</details> <code>flow</code></td>") {
+		t.Errorf("expected the source to stay in the table cell but found\n%s", output)
+	}
+
+	content = template.HTML("<p><img src='/flow.svg' class='diagram-svg' alt='diagram' data-embed='img' data-source='hidden' /></p>")
+	output = string(embedDiagrams(content, diagrams, text, options))
+	expected = "<p><img src='/flow.svg' class='diagram-svg' alt='diagram' data-embed='img' /></p>"
+	if output != expected {
+		t.Errorf("expected the hidden source to be left out\n%s\nbut found\n%s", expected, output)
+	}
+}
+
+func TestSearchableLinks(t *testing.T) {
+	leaf, err := parser.ParseMD([]byte("# Load\n\nThe load is $\\frac{r}{c}$ per node.\n"), "/", &parser.MarkdownOptions{})
+	if err != nil {
+		t.Fatalf("could not parse the math: %v", err)
+	}
+	if !strings.Contains(string(leaf.Content), "<svg") {
+		t.Fatalf("expected the math to be rendered")
+	}
+
+	links := searchableLinks([]parser.LeafData{*leaf})
+	if strings.Contains(string(links[0].Content), "<svg") {
+		t.Errorf("expected the math to be removed from the search content")
+	}
+	if !strings.Contains(string(links[0].Content), `The load is \frac{r}{c} per node.`) {
+		t.Errorf("expected the TeX to be searchable but found %s", links[0].Content)
+	}
+	if !strings.Contains(string(leaf.Content), "<svg") {
+		t.Errorf("expected the page itself to keep the math")
+	}
 }
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultConverterTimeout is how long a converter can run when the config doesn't set a timeout
+const defaultConverterTimeout = 30 * time.Second
+
+// ConverterConfig is an external command that converts the source of another diagram language, such as
+// Graphviz or PlantUML, to SVG. The source is written to its stdin and the SVG is read from its stdout.
+type ConverterConfig struct {
+	Command string   `json:"command" yaml:"command"`
+	Args    []string `json:"args" yaml:"args"`
+	Timeout string   `json:"timeout" yaml:"timeout"` // a duration such as 10s; defaults to 30s
+}
+
+// timeout parses the timeout, using the default if it isn't set
+func (converter ConverterConfig) timeout() (time.Duration, error) {
+	if converter.Timeout == "" {
+		return defaultConverterTimeout, nil
+	}
+	timeout, err := time.ParseDuration(converter.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("timeout must be a duration such as 30s but was '%s'", converter.Timeout)
+	}
+	return timeout, nil
+}
+
+// validateConverters checks each converter and keys them by the lowercase extension with the leading
+// dot, so the config can use either dot or .dot
+func validateConverters(converters map[string]ConverterConfig) (map[string]ConverterConfig, error) {
+	validated := map[string]ConverterConfig{}
+	for extension, converter := range converters {
+		extension = strings.ToLower(strings.TrimSpace(extension))
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		switch extension {
+		case ".", ".d2", ".md":
+			return nil, fmt.Errorf("converter for '%s': the extension can't be empty, .d2, or .md", extension)
+		}
+		if strings.TrimSpace(converter.Command) == "" {
+			return nil, fmt.Errorf("converter for %s: a command is required", extension)
+		}
+		if _, err := converter.timeout(); err != nil {
+			return nil, fmt.Errorf("converter for %s: %v", extension, err)
+		}
+		validated[extension] = converter
+	}
+	return validated, nil
+}
+
+// handleConverter runs the converter on the input file and writes the SVG it outputs. The command is
+// run from the directory of the input file, so any files the source refers to can be found.
+func handleConverter(inputFile string, outputFile string, converter ConverterConfig) error {
+	content, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	timeout, err := converter.timeout()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	command := exec.CommandContext(ctx, converter.Command, converter.Args...)
+	command.Dir = filepath.Dir(inputFile)
+	command.Stdin = bytes.NewReader(content)
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	err = command.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s", converter.Command, timeout)
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			return fmt.Errorf("%s: %v", converter.Command, err)
+		}
+		return fmt.Errorf("%s: %v: %s", converter.Command, err, message)
+	}
+	if !bytes.Contains(stdout.Bytes(), []byte("<svg")) {
+		return fmt.Errorf("%s did not output an SVG", converter.Command)
+	}
+	return os.WriteFile(outputFile, stdout.Bytes(), 0600)
+}
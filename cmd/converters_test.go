@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateConverters(t *testing.T) {
+	converters, err := validateConverters(map[string]ConverterConfig{
+		"DOT":   {Command: "dot", Args: []string{"-Tsvg"}},
+		".puml": {Command: "plantuml", Timeout: "1m"},
+	})
+	if err != nil {
+		t.Fatalf("expected the converters to be valid: %v", err)
+	}
+	if converters[".dot"].Command != "dot" || converters[".puml"].Command != "plantuml" {
+		t.Errorf("expected the converters to be keyed by the extension: %+v", converters)
+	}
+
+	for _, invalid := range []map[string]ConverterConfig{
+		{".dot": {}},
+		{".d2": {Command: "d2"}},
+		{".dot": {Command: "dot", Timeout: "soon"}},
+	} {
+		_, err = validateConverters(invalid)
+		if err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
+
+func TestHandleConverter(t *testing.T) {
+	r := rand.Int63()
+	testDir := fmt.Sprintf("./test_data/converter_%d", r)
+	err := os.MkdirAll(testDir, os.ModePerm)
+	if err != nil {
+		t.Fatalf("could not create filesystem: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	input := testDir + "/flow.dot"
+	err = os.WriteFile(input, []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), 0600)
+	if err != nil {
+		t.Fatalf("could not write the source: %v", err)
+	}
+
+	// cat echoes the source back, so the output is the source
+	err = handleConverter(input, testDir+"/flow.svg", ConverterConfig{Command: "cat"})
+	if err != nil {
+		t.Fatalf("expected the conversion to succeed: %v", err)
+	}
+	contents, _ := os.ReadFile(testDir + "/flow.svg")
+	if !strings.HasPrefix(string(contents), "<svg") {
+		t.Errorf("expected the SVG to be written but found %s", contents)
+	}
+
+	err = handleConverter(input, testDir+"/failed.svg", ConverterConfig{Command: "sh", Args: []string{"-c", "echo 'syntax error' >&2; exit 1"}})
+	if err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("expected the error to include stderr but was %v", err)
+	}
+	err = handleConverter(input, testDir+"/slow.svg", ConverterConfig{Command: "sleep", Args: []string{"5"}, Timeout: "100ms"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected the converter to time out but was %v", err)
+	}
+	err = handleConverter(input, testDir+"/empty.svg", ConverterConfig{Command: "true"})
+	if err == nil {
+		t.Errorf("expected an error when no SVG is output")
+	}
+	if _, err := os.Stat(testDir + "/failed.svg"); err == nil {
+		t.Errorf("expected nothing to be written when the converter fails")
+	}
+}
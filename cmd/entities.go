@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// SiteEntity is something drawn in the site's diagrams, such as a service or a database, found by the
+// full ID of its shapes
+type SiteEntity struct {
+	Key      string          // the normalized full ID, such as payments-db or store.db
+	Name     string          // how it was first drawn, which is the name of the first shape
+	Names    []string        // every ID and label it was drawn with, sorted
+	Labels   []EntityLabel   // the labels it was drawn with, sorted by their key
+	PagePath string          // the site path of its page, such as /entities/payments-db.html
+	Diagrams []EntityDiagram // the diagrams it is drawn in, sorted by their source
+}
+
+// SiteLabel is a label drawn in the site's diagrams, with every entity drawn with it, since different
+// shapes, such as orders_db and users_db, can both be labelled Database
+type SiteLabel struct {
+	Key      string       // the normalized label, such as database
+	Name     string       // the label as it was first drawn, such as Database
+	PagePath string       // the site path of its page, such as /entities/labels/database.html
+	Entities []SiteEntity // the entities drawn with it, sorted by their key
+}
+
+// EntityLabel links an entity to the page of a label it was drawn with
+type EntityLabel struct {
+	Key      string
+	Name     string
+	PagePath string
+}
+
+// EntityDiagram is a diagram an entity is drawn in, with the shapes that are the entity
+type EntityDiagram struct {
+	Diagram d2s.DiagramData
+	Shapes  []EntityShape
+}
+
+// EntityShape is a shape of an entity, with a link that highlights it on the diagram's page
+type EntityShape struct {
+	d2s.DiagramEntity
+	Name     string // the label, or the ID of text and code shapes
+	Fragment string // the fragment that highlights it, such as shape-store.db
+	Link     string // such as /diagrams/flows/login.html#shape-store.db
+}
+
+// buildEntities indexes the shapes of every D2 diagram by their full ID, so `payments-db` finds the
+// diagrams that draw a shape with that ID, and lists the entities drawn with each label, so Payments DB
+// finds them by how they were labelled. Shapes that share a label are still different entities.
+func buildEntities() {
+	paths := []string{}
+	for path := range site.Diagrams {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return site.Diagrams[paths[i]].Source < site.Diagrams[paths[j]].Source
+	})
+
+	entities := map[string]*SiteEntity{}
+	labels := map[string]*SiteLabel{}
+	for _, path := range paths {
+		diagram := site.Diagrams[path]
+		for _, shape := range diagram.Entities {
+			key := entityKey(shape.ID)
+			if key == "" {
+				continue
+			}
+			entityShape := newEntityShape(diagram, shape)
+			entity, found := entities[key]
+			if !found {
+				entity = &SiteEntity{
+					Key:      key,
+					Name:     entityShape.Name,
+					Names:    []string{},
+					Labels:   []EntityLabel{},
+					PagePath: entityPagePath(key),
+					Diagrams: []EntityDiagram{},
+				}
+				entities[key] = entity
+			}
+			entity.addNames(shape.ID, entityShape.Name)
+			last := len(entity.Diagrams) - 1
+			if last == -1 || entity.Diagrams[last].Diagram.Path != diagram.Path {
+				entity.Diagrams = append(entity.Diagrams, EntityDiagram{Diagram: diagram, Shapes: []EntityShape{}})
+				last++
+			}
+			entity.Diagrams[last].Shapes = append(entity.Diagrams[last].Shapes, entityShape)
+
+			labelKey := entityKey(shape.Label)
+			if isTextShape(shape) || labelKey == "" {
+				continue
+			}
+			label, found := labels[labelKey]
+			if !found {
+				label = &SiteLabel{
+					Key:      labelKey,
+					Name:     shape.Label,
+					PagePath: labelPagePath(labelKey),
+					Entities: []SiteEntity{},
+				}
+				labels[labelKey] = label
+			}
+			entity.addLabel(EntityLabel{Key: label.Key, Name: label.Name, PagePath: label.PagePath})
+		}
+	}
+
+	site.Entities = []SiteEntity{}
+	for _, entity := range entities {
+		sort.Strings(entity.Names)
+		sort.Slice(entity.Labels, func(i, j int) bool {
+			return entity.Labels[i].Key < entity.Labels[j].Key
+		})
+		site.Entities = append(site.Entities, *entity)
+	}
+	sort.Slice(site.Entities, func(i, j int) bool {
+		return site.Entities[i].Key < site.Entities[j].Key
+	})
+
+	// the entities are sorted, so each label lists them in order
+	for _, entity := range site.Entities {
+		for _, label := range entity.Labels {
+			labels[label.Key].Entities = append(labels[label.Key].Entities, entity)
+		}
+	}
+	site.EntityLabels = []SiteLabel{}
+	for _, label := range labels {
+		site.EntityLabels = append(site.EntityLabels, *label)
+	}
+	sort.Slice(site.EntityLabels, func(i, j int) bool {
+		return site.EntityLabels[i].Key < site.EntityLabels[j].Key
+	})
+}
+
+// addNames adds the names that aren't already on the entity
+func (entity *SiteEntity) addNames(names ...string) {
+	for _, name := range names {
+		found := false
+		for _, existing := range entity.Names {
+			if existing == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			entity.Names = append(entity.Names, name)
+		}
+	}
+}
+
+// maxEntityKeyLength is the longest key, in bytes, that is used as it is
+const maxEntityKeyLength = 64
+
+// addLabel adds the label if the entity wasn't already drawn with it
+func (entity *SiteEntity) addLabel(label EntityLabel) {
+	for _, existing := range entity.Labels {
+		if existing.Key == label.Key {
+			return
+		}
+	}
+	entity.Labels = append(entity.Labels, label)
+}
+
+// entityKey normalizes an ID or label, lowercasing it and turning anything other than letters, numbers,
+// and the dots between the parts of an ID into dashes, so Payments DB, payments_db, and payments-db
+// have the same key; keys longer than maxEntityKeyLength are shortened
+func entityKey(name string) string {
+	var key strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' {
+			if dash && key.Len() > 0 {
+				key.WriteRune('-')
+			}
+			dash = false
+			key.WriteRune(r)
+			continue
+		}
+		dash = true
+	}
+	normalized := strings.Trim(key.String(), ".-")
+	if len(normalized) <= maxEntityKeyLength {
+		return normalized
+	}
+	// a long key is cut and ends with a hash of the whole key, so it still makes a usable file name
+	sum := sha1.Sum([]byte(normalized))
+	end := maxEntityKeyLength - 9
+	for !utf8.RuneStart(normalized[end]) {
+		end--
+	}
+	return strings.TrimRight(normalized[:end], ".-") + "-" + hex.EncodeToString(sum[:4])
+}
+
+// isTextShape is true for text, markdown, and code shapes, whose label is their content rather than a name
+func isTextShape(shape d2s.DiagramEntity) bool {
+	return shape.Shape == d2target.ShapeText || shape.Shape == d2target.ShapeCode
+}
+
+// entityPagePath is where the page of the entity is published; an entity named index is moved aside
+// so it doesn't replace the list of entities
+func entityPagePath(key string) string {
+	if key == "index" {
+		key = "entity-index"
+	}
+	return "/entities/" + key + ".html"
+}
+
+// labelPagePath is where the page of the entities drawn with a label is published; labels have their
+// own directory, since a label and an ID can have the same key
+func labelPagePath(key string) string {
+	return "/entities/labels/" + key + ".html"
+}
+
+// newEntityShape links to the shape highlighted on the diagram's page, or to the SVG if it doesn't have one
+func newEntityShape(diagram d2s.DiagramData, shape d2s.DiagramEntity) EntityShape {
+	entityShape := EntityShape{
+		DiagramEntity: shape,
+		Name:          shape.Label,
+		Fragment:      "shape-" + shape.ID,
+		Link:          diagram.Path,
+	}
+	if isTextShape(shape) {
+		entityShape.Name = shape.ID
+	}
+	if diagram.PagePath != "" {
+		// the fragment is the full ID, which is unique in the diagram, escaped in the link
+		entityShape.Link = (&url.URL{Path: diagram.PagePath, Fragment: entityShape.Fragment}).String()
+	}
+	return entityShape
+}
+
+// diagramShapes lists the shapes of the diagram, for the diagram's page to highlight the one in its fragment
+func diagramShapes(diagram d2s.DiagramData) []EntityShape {
+	shapes := []EntityShape{}
+	for _, shape := range diagram.Entities {
+		shapes = append(shapes, newEntityShape(diagram, shape))
+	}
+	return shapes
+}
+
+// buildEntityPages builds the list of every entity and label, the page of each entity, with the
+// diagrams it is drawn in, and the page of each label, which lists its entities like the index
+func buildEntityPages(options *CommandOptions) error {
+	// like the diagram pages, the entities are only published in the default language
+	language := site.Languages[0]
+	links := searchableLinks(language.Links)
+	err := os.MkdirAll(filepath.Join(options.OutputDirectory, "entities", "labels"), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	var indexOutput bytes.Buffer
+	err = options.EntityIndexPageTemplate.Execute(&indexOutput, map[string]interface{}{
+		"Entities": site.Entities,
+		"Labels":   site.EntityLabels,
+		"Data":     site.Data,
+		"Strings":  language.Strings,
+	})
+	if err != nil {
+		return err
+	}
+	err = writeEntityPage(options, "/entities/index.html", d2s.LeafData{
+		Title:    language.Strings["all_entities"],
+		Content:  template.HTML(indexOutput.String()),
+		Links:    links,
+		SiteTags: language.SiteTags,
+		Data:     site.Data,
+		Language: language.Code,
+		Strings:  language.Strings,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, label := range site.EntityLabels {
+		var labelOutput bytes.Buffer
+		err := options.EntityIndexPageTemplate.Execute(&labelOutput, map[string]interface{}{
+			"Entities": label.Entities,
+			"Label":    label,
+			"Data":     site.Data,
+			"Strings":  language.Strings,
+		})
+		if err != nil {
+			return err
+		}
+		err = writeEntityPage(options, label.PagePath, d2s.LeafData{
+			Title:    label.Name,
+			Content:  template.HTML(labelOutput.String()),
+			Links:    links,
+			SiteTags: language.SiteTags,
+			Data:     site.Data,
+			Language: language.Code,
+			Strings:  language.Strings,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, entity := range site.Entities {
+		var entityOutput bytes.Buffer
+		err := options.EntityPageTemplate.Execute(&entityOutput, map[string]interface{}{
+			"Entity":  entity,
+			"Data":    site.Data,
+			"Strings": language.Strings,
+		})
+		if err != nil {
+			return err
+		}
+		err = writeEntityPage(options, entity.PagePath, d2s.LeafData{
+			Title:    entity.Name,
+			Content:  template.HTML(entityOutput.String()),
+			Links:    links,
+			SiteTags: language.SiteTags,
+			Data:     site.Data,
+			Language: language.Code,
+			Strings:  language.Strings,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEntityPage renders the page into the page template at the site path
+func writeEntityPage(options *CommandOptions, sitePath string, page d2s.LeafData) error {
+	output, err := os.Create(filepath.Join(options.OutputDirectory, filepath.FromSlash(sitePath)))
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	return executePage(options, output, page)
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestEntityKey(t *testing.T) {
+	for input, expected := range map[string]string{
+		"payments-db":            "payments-db",
+		"Payments DB":            "payments-db",
+		"payments_db":            "payments-db",
+		"  Payments -- DB ":      "payments-db",
+		"store.Payments DB":      "store.payments-db",
+		"Zahlungs-Datenbank (ß)": "zahlungs-datenbank-ß",
+		"...":                    "",
+	} {
+		if found := entityKey(input); found != expected {
+			t.Errorf("%s: expected %s but found %s", input, expected, found)
+		}
+	}
+	long := strings.Repeat("Zahlungsdatenbank ", 10)
+	if found := entityKey(long); len(found) > maxEntityKeyLength || !strings.HasPrefix(found, "zahlungsdatenbank-") || found == entityKey(long+"2") {
+		t.Errorf("expected a long key to be shortened and kept apart from the others but found %s", found)
+	}
+	if found := entityKey(strings.Repeat("ß", 40)); !utf8.ValidString(found) || len(found) > maxEntityKeyLength {
+		t.Errorf("expected a long key to be cut between letters but found %s", found)
+	}
+	if found := entityPagePath("index"); found != "/entities/entity-index.html" {
+		t.Errorf("expected an entity named index to be moved aside but found %s", found)
+	}
+}
+
+func TestBuildEntities(t *testing.T) {
+	setupSite()
+	defer setupSite()
+	site.Diagrams = map[string]d2s.DiagramData{
+		"/checkout.svg": {
+			Source:   "/checkout.d2",
+			Path:     "/checkout.svg",
+			PagePath: "/diagrams/checkout.html",
+			Entities: []d2s.DiagramEntity{
+				{ID: "api", Label: "API"},
+				{ID: "store", Label: "store"},
+				{ID: "store.db", Label: "Payments DB"},
+				{ID: "note", Label: "# Checkout\n\n" + strings.Repeat("The store keeps every payment. ", 20), Shape: "text"},
+				{ID: "a b", Label: "a b"},
+				{ID: "a_b", Label: "a_b"},
+				{ID: "\"--\"", Label: "--"},
+			},
+		},
+		"/architecture.svg": {
+			Source:   "/architecture.d2",
+			Path:     "/architecture.svg",
+			PagePath: "/diagrams/architecture.html",
+			Entities: []d2s.DiagramEntity{
+				{ID: "payments_db", Label: "payments_db"},
+				{ID: "orders_db", Label: "Database"},
+			},
+		},
+		"/users.svg": {
+			Source:   "/users.d2",
+			Path:     "/users.svg",
+			PagePath: "/diagrams/users.html",
+			Entities: []d2s.DiagramEntity{
+				{ID: "users_db", Label: "Database"},
+			},
+		},
+		"/legacy.svg": {
+			Source:    "/legacy.dot",
+			Path:      "/legacy.svg",
+			PagePath:  "/diagrams/legacy.html",
+			Converter: "dot -Tsvg",
+		},
+	}
+	buildEntities()
+
+	keys := []string{}
+	entities := map[string]SiteEntity{}
+	for _, entity := range site.Entities {
+		keys = append(keys, entity.Key)
+		entities[entity.Key] = entity
+	}
+	if strings.Join(keys, ",") != "a-b,api,note,orders-db,payments-db,store,store.db,users-db" {
+		t.Fatalf("expected an entity for each ID, sorted, but found %v", keys)
+	}
+
+	payments := entities["payments-db"]
+	if payments.Name != "payments_db" || strings.Join(payments.Names, ",") != "payments_db" || payments.PagePath != "/entities/payments-db.html" {
+		t.Errorf("expected the entity to have the names of its shapes and its page: %+v", payments)
+	}
+	if len(payments.Diagrams) != 1 || payments.Diagrams[0].Diagram.Source != "/architecture.d2" {
+		t.Errorf("expected the entity to be in its diagram: %+v", payments.Diagrams)
+	}
+	db := entities["store.db"]
+	if db.Name != "Payments DB" || strings.Join(db.Names, ",") != "Payments DB,store.db" || len(db.Diagrams) != 1 {
+		t.Fatalf("expected the labelled shape to be its own entity: %+v", db)
+	}
+	if shapes := db.Diagrams[0].Shapes; len(shapes) != 1 || shapes[0].ID != "store.db" || shapes[0].Link != "/diagrams/checkout.html#shape-store.db" {
+		t.Errorf("expected the shape to be listed once with a link that highlights it: %+v", shapes)
+	}
+	if store := entities["store"]; len(store.Diagrams) != 1 || len(store.Diagrams[0].Shapes) != 1 {
+		t.Errorf("expected a shape whose ID is its label to be listed once: %+v", store)
+	}
+	if note := entities["note"]; strings.Join(note.Names, ",") != "note" || note.Name != "note" || len(note.Labels) != 0 {
+		t.Errorf("expected a text shape to be found by its ID only: %+v", note)
+	}
+
+	// two IDs with the same label are different entities, and the label lists both
+	orders, users := entities["orders-db"], entities["users-db"]
+	if len(orders.Diagrams) != 1 || len(users.Diagrams) != 1 || orders.Diagrams[0].Diagram.Source != "/architecture.d2" || users.Diagrams[0].Diagram.Source != "/users.d2" {
+		t.Errorf("expected each ID to be its own entity: %+v %+v", orders, users)
+	}
+	if len(orders.Labels) != 1 || orders.Labels[0].PagePath != "/entities/labels/database.html" || orders.Labels[0].Name != "Database" {
+		t.Errorf("expected the entity to link to its label: %+v", orders.Labels)
+	}
+	labels := map[string]SiteLabel{}
+	labelKeys := []string{}
+	for _, label := range site.EntityLabels {
+		labels[label.Key] = label
+		labelKeys = append(labelKeys, label.Key)
+	}
+	if strings.Join(labelKeys, ",") != "a-b,api,database,payments-db,store" {
+		t.Fatalf("expected a label for each normalized label except the text, sorted, but found %v", labelKeys)
+	}
+	for key, expected := range map[string]string{"database": "orders-db,users-db", "payments-db": "payments-db,store.db"} {
+		found := []string{}
+		for _, entity := range labels[key].Entities {
+			found = append(found, entity.Key)
+		}
+		if strings.Join(found, ",") != expected {
+			t.Errorf("expected the label %s to list %s but found %v", key, expected, found)
+		}
+	}
+
+	shapes := entities["a-b"].Diagrams[0].Shapes
+	if len(shapes) != 2 || shapes[0].Fragment == shapes[1].Fragment || shapes[0].Link != "/diagrams/checkout.html#shape-a%20b" || shapes[1].Link != "/diagrams/checkout.html#shape-a_b" {
+		t.Errorf("expected each shape to have its own fragment: %+v", shapes)
+	}
+}
+
+func TestWalkDirEntities(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src/flows", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"flows/checkout.d2": "api -> store.db\nstore.db: Payments DB\nexplain: |md\n  # Checkout\n\n  " + strings.Repeat("The API saves every payment in the store. ", 10) + "\n|\n",
+		"architecture.d2":   "web -> payments-db\n",
+		"one.d2":            "orders_db: Database\n",
+		"two.d2":            "users_db: Database\n",
+		"index.md":          "---\ntitle: Home\n---\n\n{{architecture}}\n",
+		"flows/checkout.md": "---\ntitle: Checkout\n---\n\n{{checkout}}\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+
+	for page, expected := range map[string][]string{
+		"entities/index.html": {
+			"<title>All Entities</title>",
+			`<a href="/entities/payments-db.html" class="entity-index-link">payments-db</a>`,
+			`<a href="/entities/web.html" class="entity-index-link">web</a>`,
+			`<a href="/entities/labels/database.html" class="entity-label-link">Database</a>`,
+		},
+		"entities/payments-db.html": {
+			"<h1>Entity payments-db</h1>",
+			"<code>payments-db</code>",
+			`<a href="/entities/labels/payments-db.html" class="entity-label-link">payments-db</a>`,
+			`<a href="/diagrams/architecture.html" class="entity-diagram-link">/architecture.d2</a>`,
+			`<a href="/diagrams/architecture.html#shape-payments-db" class="entity-shape-link">payments-db</a>`,
+		},
+		"entities/store.db.html": {
+			"<h1>Entity Payments DB</h1>",
+			"<code>Payments DB</code>, <code>store.db</code>",
+			`<a href="/diagrams/flows/checkout.html#shape-store.db" class="entity-shape-link">Payments DB</a>`,
+		},
+		"entities/labels/payments-db.html": {
+			"<title>payments-db</title>",
+			"<h1>Label payments-db</h1>",
+			`<a href="/entities/payments-db.html" class="entity-index-link">payments-db</a>`,
+			`<a href="/entities/store.db.html" class="entity-index-link">Payments DB</a>`,
+		},
+		"entities/orders-db.html": {`<a href="/diagrams/one.html#shape-orders_db" class="entity-shape-link">Database</a>`},
+		"entities/users-db.html":  {`<a href="/diagrams/two.html#shape-users_db" class="entity-shape-link">Database</a>`},
+		"entities/labels/database.html": {
+			`<a href="/entities/orders-db.html" class="entity-index-link">Database</a>`,
+			`<a href="/entities/users-db.html" class="entity-index-link">Database</a>`,
+		},
+		"entities/explain.html": {"<h1>Entity explain</h1>", `class="entity-shape-link">explain</a>`},
+		"diagrams/flows/checkout.html": {
+			`<div class="diagram-highlight" data-highlight="shape-store.db" title="Payments DB" style="left: `,
+		},
+		"index.html": {`<a href="/entities/index.html" class="left-nav-link">All Entities</a>`},
+	} {
+		contents, err := os.ReadFile(testPath + "/build/" + page)
+		if err != nil {
+			t.Errorf("expected %s to be written: %v", page, err)
+			continue
+		}
+		for _, text := range expected {
+			if !strings.Contains(string(contents), text) {
+				t.Errorf("expected %s to contain %s but found %s", page, text, contents)
+			}
+		}
+	}
+	if contents, _ := os.ReadFile(testPath + "/build/diagrams/flows/checkout.html"); strings.Contains(string(contents), "ZgotmplZ") {
+		t.Errorf("expected the highlight to be positioned: %s", contents)
+	}
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// languageCodeRegex checks the language codes, such as de or pt-br
+var languageCodeRegex = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]+)*$`)
+
+// relativeURLRegex finds the links and sources in the content, so relative ones can be made absolute
+var relativeURLRegex = regexp.MustCompile(`\b(href|src)="([^"]*)"`)
+
+// LanguageConfig is a language the site is published in, from the languages section of the config file
+type LanguageConfig struct {
+	Name string `json:"name" yaml:"name"` // the name shown in the language switcher, such as Deutsch
+}
+
+// LanguageSite is the part of the site published in one language. Pages that haven't been translated
+// fall back to the page in the default language.
+type LanguageSite struct {
+	Code     string
+	Name     string
+	Path     string // where the language is published, such as /de, or empty for the default language
+	Links    []d2s.LeafData
+	SiteTags map[string][]d2s.LeafData
+	Strings  map[string]string
+}
+
+// validateLanguages checks the language codes, lowercasing them, and makes sure the default is set
+func validateLanguages(options *CommandOptions) error {
+	options.DefaultLanguage = strings.ToLower(strings.TrimSpace(options.DefaultLanguage))
+	if options.DefaultLanguage == "" {
+		options.DefaultLanguage = "en"
+	}
+	if !languageCodeRegex.MatchString(options.DefaultLanguage) {
+		return fmt.Errorf("default language '%s' must be a code such as en or pt-br", options.DefaultLanguage)
+	}
+	languages := map[string]LanguageConfig{}
+	for code, language := range options.Languages {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if !languageCodeRegex.MatchString(code) {
+			return fmt.Errorf("language '%s' must be a code such as en or pt-br", code)
+		}
+		languages[code] = language
+	}
+	options.Languages = languages
+	return nil
+}
+
+// isMultilingual checks if there are any languages other than the default
+func (options *CommandOptions) isMultilingual() bool {
+	for code := range options.Languages {
+		if code != options.DefaultLanguage {
+			return true
+		}
+	}
+	return false
+}
+
+// languagePath is where the language is published; the default language is at the root
+func (options *CommandOptions) languagePath(code string) string {
+	if code == options.DefaultLanguage {
+		return ""
+	}
+	return "/" + code
+}
+
+// languageName is the name of the language for the switcher, which falls back to the code
+func (options *CommandOptions) languageName(code string) string {
+	if name := options.Languages[code].Name; name != "" {
+		return name
+	}
+	return strings.ToUpper(code)
+}
+
+// pageLanguage finds the language of a Markdown file from its name, such as de for guide/intro.de.md,
+// and returns it with the path of the page without the language. Files without a known language
+// are in the default language.
+func pageLanguage(file string, options *CommandOptions) (string, string) {
+	if !options.isMultilingual() {
+		return options.DefaultLanguage, file
+	}
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	code := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	if _, found := options.Languages[code]; !found && code != options.DefaultLanguage {
+		return options.DefaultLanguage, file
+	}
+	return code, strings.TrimSuffix(name, filepath.Ext(name)) + filepath.Ext(file)
+}
+
+// relocateLinks makes the relative links and sources in the content absolute from the page's source
+// directory, since a translated page is published under its language's path instead
+func relocateLinks(content string, prefix string) string {
+	directory := path.Join("/", filepath.ToSlash(prefix))
+	return relativeURLRegex.ReplaceAllStringFunc(content, func(attribute string) string {
+		parts := relativeURLRegex.FindStringSubmatch(attribute)
+		value := parts[2]
+		if value == "" || strings.HasPrefix(value, "/") || strings.HasPrefix(value, "#") || strings.HasPrefix(value, "?") {
+			return attribute
+		}
+		end := strings.IndexAny(value, "?#")
+		if end == -1 {
+			end = len(value)
+		}
+		// anything with a scheme, such as https: or mailto:, is already absolute
+		if strings.Contains(value[:end], ":") {
+			return attribute
+		}
+		relocated := path.Join(directory, value[:end])
+		if strings.HasSuffix(value[:end], "/") {
+			relocated += "/"
+		}
+		return fmt.Sprintf(`%s="%s%s"`, parts[1], relocated, value[end:])
+	})
+}
+
+// localizeReference points a link to a page at its translation in the language, if there is one,
+// such as /guide/intro.html to /de/guide/intro.html. A link written to a translated file, such as
+// intro.de.md, is pointed at where that translation is published.
+func localizeReference(reference string, language string, pages map[string]*d2s.LeafData, options *CommandOptions) string {
+	target, anchor, hasAnchor := strings.Cut(reference, "#")
+	if !options.isMultilingual() || !strings.HasSuffix(target, ".html") {
+		return reference
+	}
+	if code, untranslated := pageLanguage(target, options); untranslated != target {
+		language, target = code, untranslated
+	}
+	if localized := options.languagePath(language) + target; pages[localized] != nil {
+		target = localized
+	}
+	if hasAnchor {
+		target += "#" + anchor
+	}
+	return target
+}
+
+// buildLanguages splits the site into its languages once every page is known, linking the translations
+// of each page to each other and loading the text for the templates
+func buildLanguages(options *CommandOptions) {
+	codes := []string{}
+	for code := range options.Languages {
+		if code != options.DefaultLanguage {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	codes = append([]string{options.DefaultLanguage}, codes...)
+
+	// the translations are matched by where the page would be published in the default language
+	translations := map[string]map[string]*d2s.LeafData{}
+	for i := range site.Links {
+		page := &site.Links[i]
+		key := strings.TrimPrefix(filepath.ToSlash(page.FileName), page.LanguagePath)
+		if translations[key] == nil {
+			translations[key] = map[string]*d2s.LeafData{}
+		}
+		if existing, found := translations[key][page.Language]; found {
+			traverseErrors = append(traverseErrors, fmt.Errorf("%s: is the same page in %s as %s", page.FileName, page.Language, existing.FileName))
+			continue
+		}
+		translations[key][page.Language] = page
+	}
+	for i := range site.Links {
+		page := &site.Links[i]
+		page.Translations = []d2s.Translation{}
+		key := strings.TrimPrefix(filepath.ToSlash(page.FileName), page.LanguagePath)
+		for _, code := range codes {
+			if translation, found := translations[key][code]; found && code != page.Language {
+				page.Translations = append(page.Translations, d2s.Translation{
+					Language: code,
+					Name:     options.languageName(code),
+					FileName: translation.FileName,
+				})
+			}
+		}
+	}
+
+	site.Languages = []*LanguageSite{}
+	for _, code := range codes {
+		text, err := loadStrings(options, code)
+		if err != nil {
+			traverseErrors = append(traverseErrors, err)
+		}
+		language := &LanguageSite{
+			Code:     code,
+			Name:     options.languageName(code),
+			Path:     options.languagePath(code),
+			Links:    []d2s.LeafData{},
+			SiteTags: map[string][]d2s.LeafData{},
+			Strings:  text,
+		}
+		for i := range site.Links {
+			page := site.Links[i]
+			key := strings.TrimPrefix(filepath.ToSlash(page.FileName), page.LanguagePath)
+			_, translated := translations[key][code]
+			if page.Language != code && (page.Language != options.DefaultLanguage || translated) {
+				continue
+			}
+			language.Links = append(language.Links, page)
+			for _, tag := range page.Tags {
+				language.SiteTags[tag] = append(language.SiteTags[tag], page)
+			}
+		}
+		site.Languages = append(site.Languages, language)
+	}
+}
+
+// languageSite finds the part of the site for the language, falling back to the default language
+func (site *SiteData) languageSite(code string) *LanguageSite {
+	for _, language := range site.Languages {
+		if language.Code == code {
+			return language
+		}
+	}
+	return site.Languages[0]
+}
+
+// loadStrings loads the text for the templates in the language. The embedded English is used for
+// anything the language files in the i18n directory don't set, with the default language's file
+// filling in for any key that is missing from the language's own file.
+func loadStrings(options *CommandOptions, code string) (map[string]string, error) {
+	loaded := map[string]string{}
+	err := yaml.Unmarshal([]byte(stringsEmbedString), &loaded)
+	if err != nil {
+		return loaded, err
+	}
+	if options.I18nDirectory == "" {
+		return loaded, nil
+	}
+	for _, file := range []string{options.DefaultLanguage, code} {
+		contents, err := os.ReadFile(filepath.Join(options.I18nDirectory, file+".yaml"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return loaded, err
+		}
+		translated := map[string]string{}
+		err = yaml.Unmarshal(contents, &translated)
+		if err != nil {
+			return loaded, fmt.Errorf("language file %s.yaml: %v", file, err)
+		}
+		for key, value := range translated {
+			loaded[key] = value
+		}
+	}
+	return loaded, nil
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestValidateLanguages(t *testing.T) {
+	options := &CommandOptions{
+		Languages: map[string]LanguageConfig{"DE": {Name: "Deutsch"}, "pt-BR": {}},
+	}
+	err := validateLanguages(options)
+	if err != nil {
+		t.Fatalf("expected the languages to be valid: %v", err)
+	}
+	if options.DefaultLanguage != "en" || options.Languages["de"].Name != "Deutsch" {
+		t.Errorf("expected the codes to be lowercased with en as the default: %+v", options)
+	}
+	if _, found := options.Languages["pt-br"]; !found {
+		t.Errorf("expected pt-br to be kept: %+v", options.Languages)
+	}
+	if !options.isMultilingual() || options.languageName("pt-br") != "PT-BR" {
+		t.Errorf("expected the site to be multilingual with the code as the fallback name")
+	}
+
+	for _, input := range []*CommandOptions{
+		{DefaultLanguage: "english"},
+		{Languages: map[string]LanguageConfig{"de/": {}}},
+	} {
+		if err := validateLanguages(input); err == nil {
+			t.Errorf("expected %+v to be invalid", input)
+		}
+	}
+}
+
+func TestPageLanguage(t *testing.T) {
+	options := &CommandOptions{DefaultLanguage: "en", Languages: map[string]LanguageConfig{"en": {}, "de": {}}}
+	for _, test := range []struct {
+		File     string
+		Language string
+		Page     string
+	}{
+		{File: "/guide/intro.md", Language: "en", Page: "/guide/intro.md"},
+		{File: "/guide/intro.de.md", Language: "de", Page: "/guide/intro.md"},
+		{File: "/guide/intro.en.md", Language: "en", Page: "/guide/intro.md"},
+		{File: "/guide/intro.DE.html", Language: "de", Page: "/guide/intro.html"},
+		{File: "/guide/release.v2.md", Language: "en", Page: "/guide/release.v2.md"},
+	} {
+		language, page := pageLanguage(test.File, options)
+		if language != test.Language || page != test.Page {
+			t.Errorf("%s: expected %s and %s but found %s and %s", test.File, test.Language, test.Page, language, page)
+		}
+	}
+
+	// a site in a single language leaves the names alone
+	language, page := pageLanguage("/intro.de.md", &CommandOptions{DefaultLanguage: "en"})
+	if language != "en" || page != "/intro.de.md" {
+		t.Errorf("expected the single language site to ignore the suffix but found %s and %s", language, page)
+	}
+}
+
+func TestRelocateLinks(t *testing.T) {
+	content := `<a href="login.html#step">x</a><a href="../index.html">y</a><img src="flow.svg" />` +
+		`<a href="/abs.html">z</a><a href="#top">t</a><a href="https://example.com">e</a><a href="mailto:a@b.c">m</a><a href="sub/">s</a>`
+	expected := `<a href="/user_flows/login.html#step">x</a><a href="/index.html">y</a><img src="/user_flows/flow.svg" />` +
+		`<a href="/abs.html">z</a><a href="#top">t</a><a href="https://example.com">e</a><a href="mailto:a@b.c">m</a><a href="/user_flows/sub/">s</a>`
+	if found := relocateLinks(content, "/user_flows/"); found != expected {
+		t.Errorf("expected\n%s\nbut found\n%s", expected, found)
+	}
+}
+
+func TestLocalizeReference(t *testing.T) {
+	options := &CommandOptions{DefaultLanguage: "en", Languages: map[string]LanguageConfig{"de": {}}}
+	pages := map[string]*d2s.LeafData{
+		"/index.html":    {},
+		"/de/index.html": {},
+		"/about.html":    {},
+	}
+	for _, test := range []struct {
+		Reference string
+		Language  string
+		Expected  string
+	}{
+		{Reference: "/index.html#top", Language: "de", Expected: "/de/index.html#top"},
+		{Reference: "/index.html", Language: "en", Expected: "/index.html"},
+		{Reference: "/about.html", Language: "de", Expected: "/about.html"},
+		{Reference: "/index.de.html", Language: "en", Expected: "/de/index.html"},
+		{Reference: "/flow.svg", Language: "de", Expected: "/flow.svg"},
+	} {
+		if found := localizeReference(test.Reference, test.Language, pages, options); found != test.Expected {
+			t.Errorf("%s in %s: expected %s but found %s", test.Reference, test.Language, test.Expected, found)
+		}
+	}
+}
+
+func TestLoadStrings(t *testing.T) {
+	directory := t.TempDir()
+	err := os.WriteFile(directory+"/en.yaml", []byte("pages: Documents\nsearch: Find\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not write the default language file: %v", err)
+	}
+	err = os.WriteFile(directory+"/de.yaml", []byte("pages: Seiten\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not write the language file: %v", err)
+	}
+	options := &CommandOptions{DefaultLanguage: "en", I18nDirectory: directory}
+
+	text, err := loadStrings(options, "de")
+	if err != nil {
+		t.Fatalf("could not load the strings: %v", err)
+	}
+	if text["pages"] != "Seiten" || text["search"] != "Find" || text["tags"] != "Tags" {
+		t.Errorf("expected the language, then the default language, then the embedded strings: %v", text)
+	}
+
+	err = os.WriteFile(directory+"/fr.yaml", []byte("pages: [nope"), 0600)
+	if err != nil {
+		t.Fatalf("could not write the broken language file: %v", err)
+	}
+	if _, err := loadStrings(options, "fr"); err == nil {
+		t.Errorf("expected the broken language file to be an error")
+	}
+}
+
+func TestWalkDirLanguages(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	for _, directory := range []string{"src/guide", "i18n"} {
+		err := os.MkdirAll(testPath+"/"+directory, os.ModePerm)
+		if err != nil {
+			t.Fatalf("tried to create test dir but could not: %v", err)
+		}
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"src/index.md":            "---\ntags: [\"home\"]\n---\n# Home\n\nRead the [[Intro]] and [about](about.md).\n\n{{flow}}\n",
+		"src/index.de.md":         "---\ntags: [\"start\"]\n---\n# Startseite\n\nLies die [[Intro]] und [about](about.md).\n\n{{flow}}\n",
+		"src/about.md":            "# About\n\nOnly in English.\n",
+		"src/guide/intro.md":      "# Intro\n\nHello\n",
+		"src/guide/intro.de.md":   "# Intro\n\nHallo\n",
+		"src/guide/command.md":    "Run it.\n",
+		"src/guide/command.de.md": "Starte es.\n",
+		"src/flow.d2":             "a -> b\n",
+		"i18n/de.yaml":            "pages: Seiten\nsearch_results: Suchergebnisse\n",
+		"i18n/en.yaml":            "diagram_index: Every Diagram\nembedded_in: Used On\nno_decisions: Nothing has been decided\nshape_count: \"%d boxes\"\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(testPath+"/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err := execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		I18nDirectory:   testPath + "/i18n",
+		Languages:       map[string]LanguageConfig{"de": {Name: "Deutsch"}},
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+
+	for page, expected := range map[string][]string{
+		"index.html": {
+			`lang="en"`,
+			`<a href="/guide/intro.html" class="wiki-link"`,
+			`<a href="/de/index.html" hreflang="de" lang="de" class="left-nav-link">Deutsch</a>`,
+			`href="/tags/home"`,
+			">Pages<",
+		},
+		"de/index.html": {
+			`lang="de"`,
+			`<a href="/de/guide/intro.html" class="wiki-link"`,
+			`<a href="/about.html">about</a>`,
+			`/flow.svg`,
+			`<a href="/index.html" hreflang="en" lang="en" class="left-nav-link">EN</a>`,
+			`href="/de/tags/start"`,
+			`action="/de/search/"`,
+			">Seiten<",
+		},
+		"de/guide/intro.html":   {"Hallo"},
+		"de/guide/command.html": {"<title>command</title>"},
+		"guide/command.html":    {"<title>command</title>"},
+		"de/tags/start.html":    {`<a href="/de/index.html">Startseite</a>`},
+		"de/search.html":        {"<h1>Suchergebnisse</h1>", `"/about.html"`},
+		"guide/intro.html":      {"Hello"},
+		"tags/home.html":        {`<a href="/index.html">Home</a>`},
+		"search.html":           {"<h1>Search Results</h1>"},
+		"diagram_index.html":    {`lang="en"`, "<h1>Every Diagram</h1>", "<strong>Used On</strong>", "<strong>Summary</strong>", "2 boxes, 1 connection<"},
+		"decisions.html":        {"<h1>Decisions</h1>", "<p>Nothing has been decided</p>"},
+		"flow.svg":              {"<svg"},
+	} {
+		contents, err := os.ReadFile(testPath + "/build/" + page)
+		if err != nil {
+			t.Errorf("expected %s to be written: %v", page, err)
+			continue
+		}
+		for _, text := range expected {
+			if !strings.Contains(string(contents), text) {
+				t.Errorf("expected %s to contain %s but found %s", page, text, contents)
+			}
+		}
+	}
+	for _, missing := range []string{"de/about.html", "index.de.html", "tags/start.html"} {
+		if _, err := os.Stat(testPath + "/build/" + missing); err == nil {
+			t.Errorf("expected %s not to be written", missing)
+		}
+	}
+	if len(site.Languages) != 2 || len(site.Languages[1].Links) != 4 {
+		t.Errorf("expected the German site to have its three pages and the English fallback: %+v", site.Languages)
+	}
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+)
+
+// resolveLinks runs once every page is known. It resolves the [[Page]] wiki links on each page against
+// the titles and paths of the site, and checks that links to other Markdown files point at a page that
+// was built. Any link that can't be resolved is a warning, or an error if the options are strict.
+func resolveLinks(options *CommandOptions) {
+	pages := map[string]*d2s.LeafData{}
+	// wiki links match titles in the page's own language first, then in the default language
+	languageTitles := map[string]map[string][]*d2s.LeafData{}
+	for i := range site.Links {
+		page := &site.Links[i]
+		pages[filepath.ToSlash(page.FileName)] = page
+		if languageTitles[page.Language] == nil {
+			languageTitles[page.Language] = map[string][]*d2s.LeafData{}
+		}
+		title := strings.ToLower(page.Title)
+		if title != "" {
+			languageTitles[page.Language][title] = append(languageTitles[page.Language][title], page)
+		}
+	}
+
+	for i := range site.Links {
+		page := &site.Links[i]
+		titles := map[string][]*d2s.LeafData{}
+		for title, match := range languageTitles[options.DefaultLanguage] {
+			titles[title] = match
+		}
+		for title, match := range languageTitles[page.Language] {
+			titles[title] = match
+		}
+		content := localizeLinks(string(page.Content), page, pages, options)
+		content = d2s.WikiLinkRegex.ReplaceAllStringFunc(content, func(link string) string {
+			target := html.UnescapeString(d2s.WikiLinkRegex.FindStringSubmatch(link)[1])
+			href, err := resolveWikiLink(target, page, pages, titles, options)
+			if err != nil {
+				reportLinkProblem(options, fmt.Errorf("%s: %v", page.FileName, err))
+				return strings.Replace(link, `class="wiki-link"`, `class="wiki-link wiki-link-missing"`, 1)
+			}
+			href = localizeReference(href, page.Language, pages, options)
+			page.References = append(page.References, href)
+			return strings.Replace(link, `href="#"`, fmt.Sprintf(`href="%s"`, template.HTMLEscapeString(href)), 1)
+		})
+		page.Content = template.HTML(content)
+
+		for _, reference := range page.References {
+			err := checkReference(reference, pages)
+			if err != nil {
+				reportLinkProblem(options, fmt.Errorf("%s: %v", page.FileName, err))
+			}
+		}
+	}
+}
+
+// localizeLinks points the page's links to other Markdown files at the translations in the page's
+// language, updating both the content and the references. The links are already absolute, since
+// the content of a multilingual site is relocated when it is walked.
+func localizeLinks(content string, page *d2s.LeafData, pages map[string]*d2s.LeafData, options *CommandOptions) string {
+	for i, reference := range page.References {
+		localized := localizeReference(reference, page.Language, pages, options)
+		if localized == reference {
+			continue
+		}
+		target, _, _ := strings.Cut(reference, "#")
+		localizedTarget, _, _ := strings.Cut(localized, "#")
+		content = strings.ReplaceAll(content, fmt.Sprintf(`href="%s"`, target), fmt.Sprintf(`href="%s"`, localizedTarget))
+		content = strings.ReplaceAll(content, fmt.Sprintf(`href="%s#`, target), fmt.Sprintf(`href="%s#`, localizedTarget))
+		page.References[i] = localized
+	}
+	return content
+}
+
+// resolveWikiLink finds the page for a wiki link target, which may be a title or a path, with
+// an optional #heading; a target of just #heading links to the same page. A title shared by
+// several pages links to the first one walked, and is reported since it may not be the one meant.
+func resolveWikiLink(target string, page *d2s.LeafData, pages map[string]*d2s.LeafData, titles map[string][]*d2s.LeafData, options *CommandOptions) (string, error) {
+	name, anchor, _ := strings.Cut(target, "#")
+	name = strings.TrimSpace(name)
+
+	var found *d2s.LeafData
+	if name == "" {
+		found = page
+	} else {
+		trimmed := strings.TrimSuffix(strings.TrimSuffix(filepath.ToSlash(name), ".md"), ".html")
+		candidates := []string{
+			path.Join(path.Dir(filepath.ToSlash(page.FileName)), trimmed) + ".html",
+			path.Join("/", trimmed) + ".html",
+		}
+		for _, candidate := range candidates {
+			if match, ok := pages[candidate]; ok {
+				found = match
+				break
+			}
+		}
+		if matches := titles[strings.ToLower(name)]; found == nil && len(matches) > 0 {
+			found = matches[0]
+			if len(matches) > 1 {
+				files := []string{}
+				for _, match := range matches {
+					files = append(files, filepath.ToSlash(match.FileName))
+				}
+				reportLinkProblem(options, fmt.Errorf("%s: wiki link [[%s]] matches the title of more than one page (%s), so it links to the first", page.FileName, target, strings.Join(files, ", ")))
+			}
+		}
+	}
+	if found == nil {
+		return "", fmt.Errorf("wiki link [[%s]] does not match the title or path of any page", target)
+	}
+
+	href := filepath.ToSlash(found.FileName)
+	if anchor != "" {
+		id := findAnchor(anchor, found)
+		if id == "" {
+			return "", fmt.Errorf("wiki link [[%s]] points at a heading that is not on %s", target, href)
+		}
+		href += "#" + id
+	}
+	return href, nil
+}
+
+// findAnchor matches the anchor against the page's heading IDs, either as the ID or as the heading text
+func findAnchor(anchor string, page *d2s.LeafData) string {
+	for _, candidate := range []string{anchor, d2s.Slugify(anchor)} {
+		for _, id := range page.Anchors {
+			if id == candidate {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// checkReference makes sure a link to another page, such as /dir/page.html#heading, exists
+func checkReference(reference string, pages map[string]*d2s.LeafData) error {
+	target, anchor, _ := strings.Cut(reference, "#")
+	page, found := pages[target]
+	if !found {
+		return fmt.Errorf("link to %s does not point at a page in the site", strings.TrimSuffix(target, ".html")+".md")
+	}
+	if anchor != "" && findAnchor(anchor, page) != anchor {
+		return fmt.Errorf("link to %s points at a heading that is not on the page", reference)
+	}
+	return nil
+}
+
+// d2LinkResolver resolves the links on the shapes of one diagram against the site
+type d2LinkResolver struct {
+	source       string                   // the site path of the diagram's source, such as /flows/login.d2
+	pages        map[string]*d2s.LeafData // every page, by its site path
+	diagramPages map[string]string        // the site path of each diagram's page, by the site path of its source
+	outputs      map[string]bool          // the site paths the diagrams are written to, such as their SVGs
+	options      *CommandOptions
+}
+
+// ResolveLink rewrites the link on a D2 shape to the site. Links to Markdown files, such as
+// ../payments/overview.md#setup, point at the page built from them, links to diagram sources, such as
+// servers.d2, point at the diagram's page, and links to any other file in the site are made root-relative,
+// since a diagram can be shown from a page in another directory. All of them are put under the base URL,
+// since the SVG is also opened on its own. Relative links are from the diagram's directory. A link
+// that points nowhere is reported the same as a broken link in a page, and is left as written.
+func (resolver *d2LinkResolver) ResolveLink(link string) string {
+	destination, err := url.Parse(link)
+	if err != nil || destination.Scheme != "" || destination.Host != "" || destination.Path == "" {
+		return link
+	}
+	target := destination.Path
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join(path.Dir(resolver.source), target)
+	}
+	if strings.HasSuffix(target, ".md") {
+		// the diagrams are shared by every language, so they link to the default language
+		destination.Path = strings.TrimSuffix(target, ".md") + ".html"
+		reference := localizeReference(destination.String(), resolver.options.DefaultLanguage, resolver.pages, resolver.options)
+		err = checkReference(reference, resolver.pages)
+		if err != nil {
+			reportLinkProblem(resolver.options, fmt.Errorf("%s: %v", resolver.source, err))
+			return link
+		}
+		return resolver.options.BaseURL + reference
+	}
+	if page, found := resolver.diagramPages[target]; found {
+		destination.Path = page
+		return resolver.options.BaseURL + destination.String()
+	}
+	if strings.HasSuffix(target, ".d2") {
+		reportLinkProblem(resolver.options, fmt.Errorf("%s: link to %s does not point at a diagram in the site", resolver.source, link))
+		return link
+	}
+	_, isPage := resolver.pages[target]
+	if !isPage && !resolver.outputs[target] {
+		if _, err := os.Stat(filepath.Join(resolver.options.InputDirectory, filepath.FromSlash(target))); err != nil {
+			reportLinkProblem(resolver.options, fmt.Errorf("%s: link to %s does not point at a page, diagram, or file in the site", resolver.source, link))
+			return link
+		}
+	}
+	destination.Path = target
+	return resolver.options.BaseURL + destination.String()
+}
+
+// validateBaseURL checks the URL the site is served from, which is either a full URL, such as
+// https://example.com/docs, or a path, such as /docs, and drops the trailing slash so site paths can
+// be added to it
+func validateBaseURL(baseURL string) (string, error) {
+	baseURL = strings.TrimSuffix(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.RawQuery != "" || parsed.Fragment != "" ||
+		(parsed.Scheme == "" && (parsed.Host != "" || !strings.HasPrefix(parsed.Path, "/"))) ||
+		(parsed.Scheme != "" && parsed.Host == "") {
+		return "", fmt.Errorf("base URL %s must be a URL, such as https://example.com/docs, or a path, such as /docs", baseURL)
+	}
+	return baseURL, nil
+}
+
+// baseURLRegex finds the attributes that hold links starting with a slash, along with the start and
+// end of the inlined SVGs
+var baseURLRegex = regexp.MustCompile(`(?i)<svg\b|</svg>|\s(?:href|src|action)=["']/`)
+
+// applyBaseURL puts the root-relative links in the attributes of the HTML, such as href="/guide/intro.html",
+// under the base URL. Links on another host, such as //cdn.example.com, are left alone, as are the
+// inlined diagrams, since the links on their shapes already have the base URL.
+func applyBaseURL(html string, baseURL string) string {
+	if baseURL == "" {
+		return html
+	}
+	var output strings.Builder
+	last := 0
+	depth := 0
+	for _, match := range baseURLRegex.FindAllStringIndex(html, -1) {
+		found := strings.ToLower(html[match[0]:match[1]])
+		switch {
+		case strings.HasPrefix(found, "<svg"):
+			depth++
+		case found == "</svg>":
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && !strings.HasPrefix(html[match[1]:], "/"):
+			// the base URL goes in front of the slash
+			output.WriteString(html[last : match[1]-1])
+			output.WriteString(baseURL)
+			last = match[1] - 1
+		}
+	}
+	output.WriteString(html[last:])
+	return output.String()
+}
+
+// reportLinkProblem either records the problem as an error or prints it as a warning
+func reportLinkProblem(options *CommandOptions, err error) {
+	if options.StrictLinks {
+		traverseErrors = append(traverseErrors, err)
+		return
+	}
+	fmt.Printf("warning: %v\n", err)
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestResolveLinks(t *testing.T) {
+	setupSite()
+	defer setupSite()
+	traverseErrors = []error{}
+	defer func() {
+		traverseErrors = []error{}
+	}()
+
+	pages := []struct {
+		Name     string
+		Prefix   string
+		Markdown string
+	}{
+		{Name: "/index.html", Prefix: "/", Markdown: "# Home\n\nSee [[Login Flow]], [[user_flows/login#Step Two|step two]], [[login flow#step-two]], and [[#home]].\n\n[Login](user_flows/login.md#step-two)\n"},
+		{Name: "/user_flows/login.html", Prefix: "/user_flows/", Markdown: "# Login Flow\n\n## Step Two\n\nBack [[Home]] and [[Missing Page]] and [[Home#Nowhere]] and [missing](missing.md)\n"},
+	}
+	for _, page := range pages {
+		leaf, err := d2s.ParseMD([]byte(page.Markdown), page.Prefix, nil)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", page.Name, err)
+		}
+		leaf.FileName = page.Name
+		site.Links = append(site.Links, *leaf)
+	}
+
+	// by default, the problems are only warnings
+	options := &CommandOptions{}
+	resolveLinks(options)
+	if len(traverseErrors) != 0 {
+		t.Errorf("expected no errors without strict links but found %v", traverseErrors)
+	}
+	home := string(site.Links[0].Content)
+	for _, expected := range []string{
+		`<a href="/user_flows/login.html" class="wiki-link" data-wiki-link="Login Flow">Login Flow</a>`,
+		`<a href="/user_flows/login.html#step-two" class="wiki-link" data-wiki-link="user_flows/login#Step Two">step two</a>`,
+		`<a href="/user_flows/login.html#step-two" class="wiki-link" data-wiki-link="login flow#step-two">`,
+		`<a href="/index.html#home" class="wiki-link" data-wiki-link="#home">`,
+		`<a href="user_flows/login.html#step-two">Login</a>`,
+	} {
+		if !strings.Contains(home, expected) {
+			t.Errorf("expected the home page to contain %s but found %s", expected, home)
+		}
+	}
+	login := string(site.Links[1].Content)
+	if !strings.Contains(login, `<a href="/index.html" class="wiki-link"`) {
+		t.Errorf("expected the link back home to resolve: %s", login)
+	}
+	if strings.Count(login, "wiki-link-missing") != 2 {
+		t.Errorf("expected the two broken wiki links to be marked: %s", login)
+	}
+	if len(site.Links[0].References) != 5 {
+		t.Errorf("expected the resolved wiki links to be added to the references: %v", site.Links[0].References)
+	}
+
+	// and errors when strict
+	leaf, _ := d2s.ParseMD([]byte(pages[1].Markdown), pages[1].Prefix, nil)
+	site.Links[1].Content = leaf.Content
+	site.Links[1].References = leaf.References
+	options.StrictLinks = true
+	resolveLinks(options)
+	if len(traverseErrors) != 3 {
+		t.Errorf("expected 3 errors with strict links but found %d: %v", len(traverseErrors), traverseErrors)
+	}
+}
+
+func TestResolveLinksDuplicateTitles(t *testing.T) {
+	setupSite()
+	defer setupSite()
+	traverseErrors = []error{}
+	defer func() {
+		traverseErrors = []error{}
+	}()
+
+	pages := []struct {
+		Name     string
+		Prefix   string
+		Markdown string
+	}{
+		{Name: "/index.html", Prefix: "/", Markdown: "# Home\n\nSee [[Setup]] and [[api/setup]].\n"},
+		{Name: "/api/setup.html", Prefix: "/api/", Markdown: "# Setup\n"},
+		{Name: "/web/setup.html", Prefix: "/web/", Markdown: "# Setup\n"},
+	}
+	for _, page := range pages {
+		leaf, err := d2s.ParseMD([]byte(page.Markdown), page.Prefix, nil)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", page.Name, err)
+		}
+		leaf.FileName = page.Name
+		site.Links = append(site.Links, *leaf)
+	}
+
+	resolveLinks(&CommandOptions{StrictLinks: true})
+	if len(traverseErrors) != 1 || !strings.Contains(traverseErrors[0].Error(), "/api/setup.html, /web/setup.html") {
+		t.Errorf("expected only the link by title to be reported as ambiguous but found %v", traverseErrors)
+	}
+	if home := string(site.Links[0].Content); strings.Count(home, `href="/api/setup.html"`) != 2 {
+		t.Errorf("expected both links to still go to the first page walked: %s", home)
+	}
+}
+
+func TestResolveD2Link(t *testing.T) {
+	traverseErrors = []error{}
+	defer func() {
+		traverseErrors = []error{}
+	}()
+	inputDirectory := t.TempDir()
+	err := os.MkdirAll(inputDirectory+"/assets", os.ModePerm)
+	if err != nil {
+		t.Fatalf("could not create the assets directory: %v", err)
+	}
+	err = os.WriteFile(inputDirectory+"/assets/spec.pdf", []byte("pdf"), 0600)
+	if err != nil {
+		t.Fatalf("could not write the asset: %v", err)
+	}
+
+	resolver := &d2LinkResolver{
+		source: "/architecture/overview.d2",
+		pages: map[string]*d2s.LeafData{
+			"/payments/overview.html":  {Anchors: []string{"setup"}},
+			"/architecture/notes.html": {},
+		},
+		diagramPages: map[string]string{"/architecture/servers.d2": "/diagrams/architecture/servers.html"},
+		outputs:      map[string]bool{"/architecture/servers.svg": true},
+		options:      &CommandOptions{InputDirectory: inputDirectory, DefaultLanguage: "en", StrictLinks: true},
+	}
+	for _, test := range []struct {
+		Link     string
+		Expected string
+	}{
+		{Link: "../payments/overview.md", Expected: "/payments/overview.html"},
+		{Link: "../payments/overview.md#setup", Expected: "/payments/overview.html#setup"},
+		{Link: "/payments/overview.md", Expected: "/payments/overview.html"},
+		{Link: "servers.d2", Expected: "/diagrams/architecture/servers.html"},
+		{Link: "./notes.html", Expected: "/architecture/notes.html"},
+		{Link: "servers.svg", Expected: "/architecture/servers.svg"},
+		{Link: "../assets/spec.pdf", Expected: "/assets/spec.pdf"},
+		{Link: "https://example.com/docs.md", Expected: "https://example.com/docs.md"},
+		{Link: "mailto:team@example.com", Expected: "mailto:team@example.com"},
+		{Link: "#top", Expected: "#top"},
+	} {
+		if found := resolver.ResolveLink(test.Link); found != test.Expected {
+			t.Errorf("%s: expected %s but found %s", test.Link, test.Expected, found)
+		}
+	}
+	if len(traverseErrors) != 0 {
+		t.Errorf("expected every link to resolve but found %v", traverseErrors)
+	}
+
+	// the links that point nowhere are left alone and reported
+	for _, link := range []string{"missing.md", "../payments/overview.md#nowhere", "clients.d2", "../assets/missing.pdf"} {
+		if found := resolver.ResolveLink(link); found != link {
+			t.Errorf("%s: expected the link to be left alone but found %s", link, found)
+		}
+	}
+	if len(traverseErrors) != 4 {
+		t.Fatalf("expected each broken link to be reported but found %v", traverseErrors)
+	}
+	if !strings.HasPrefix(traverseErrors[0].Error(), "/architecture/overview.d2: link to /architecture/missing.md") {
+		t.Errorf("expected the error to name the diagram but found %v", traverseErrors[0])
+	}
+
+	// with a base URL, the resolved links are put under it
+	resolver.options.BaseURL = "/docs"
+	for _, test := range []struct {
+		Link     string
+		Expected string
+	}{
+		{Link: "../payments/overview.md#setup", Expected: "/docs/payments/overview.html#setup"},
+		{Link: "servers.d2", Expected: "/docs/diagrams/architecture/servers.html"},
+		{Link: "../assets/spec.pdf", Expected: "/docs/assets/spec.pdf"},
+		{Link: "https://example.com/docs.md", Expected: "https://example.com/docs.md"},
+	} {
+		if found := resolver.ResolveLink(test.Link); found != test.Expected {
+			t.Errorf("%s: expected %s but found %s", test.Link, test.Expected, found)
+		}
+	}
+}
+
+func TestValidateBaseURL(t *testing.T) {
+	for _, test := range []struct {
+		BaseURL  string
+		Expected string
+		Error    bool
+	}{
+		{BaseURL: "", Expected: ""},
+		{BaseURL: "/", Expected: ""},
+		{BaseURL: "/docs/", Expected: "/docs"},
+		{BaseURL: "https://example.com/docs/", Expected: "https://example.com/docs"},
+		{BaseURL: "https://example.com", Expected: "https://example.com"},
+		{BaseURL: "docs", Error: true},
+		{BaseURL: "//cdn.example.com", Error: true},
+		{BaseURL: "https://example.com?version=1", Error: true},
+		{BaseURL: "/docs#top", Error: true},
+	} {
+		found, err := validateBaseURL(test.BaseURL)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%s: expected an error but found %s", test.BaseURL, found)
+			}
+			continue
+		}
+		if err != nil || found != test.Expected {
+			t.Errorf("%s: expected %s but found %s %v", test.BaseURL, test.Expected, found, err)
+		}
+	}
+}
+
+func TestApplyBaseURL(t *testing.T) {
+	html := `<link rel="stylesheet" href="/app.css"><a href='/guide/intro.html' hreflang="en">Intro</a>` +
+		`<img src="/flows/login.svg"><form action="/search.html"></form>` +
+		`<a href="//cdn.example.com/lib.js">CDN</a><a href="#top">Top</a><a href="https://example.com/">Site</a><a href="notes.html">Notes</a>` +
+		`<svg viewBox="0 0 10 10"><a href="/docs/payments/overview.html"></a></svg><a href="/after.html">After</a>`
+	expected := `<link rel="stylesheet" href="/docs/app.css"><a href='/docs/guide/intro.html' hreflang="en">Intro</a>` +
+		`<img src="/docs/flows/login.svg"><form action="/docs/search.html"></form>` +
+		`<a href="//cdn.example.com/lib.js">CDN</a><a href="#top">Top</a><a href="https://example.com/">Site</a><a href="notes.html">Notes</a>` +
+		`<svg viewBox="0 0 10 10"><a href="/docs/payments/overview.html"></a></svg><a href="/docs/after.html">After</a>`
+	if found := applyBaseURL(html, "/docs"); found != expected {
+		t.Errorf("expected %s but found %s", expected, found)
+	}
+	if found := applyBaseURL(html, ""); found != html {
+		t.Errorf("expected the links to be left alone without a base URL but found %s", found)
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+)
+
+// pageReference creates the reference to a page
+func pageReference(leaf *d2s.LeafData) d2s.PageReference {
+	return d2s.PageReference{
+		Title:    leaf.Title,
+		FileName: leaf.FileName,
+		Summary:  leaf.Summary,
+	}
+}
+
+// addPageReference adds the reference if the page isn't already in the list
+func addPageReference(references []d2s.PageReference, reference d2s.PageReference) []d2s.PageReference {
+	for i := range references {
+		if references[i].FileName == reference.FileName {
+			return references
+		}
+	}
+	return append(references, reference)
+}
+
+// buildReferences fills in the backlinks for each page from the links on every other page, and for
+// each diagram on a page, the other pages that embed it from the diagrams collected on the walk.
+// This needs to run after the links are resolved so the wiki links are included.
+func buildReferences() {
+	backlinks := map[string][]d2s.PageReference{}
+	for i := range site.Links {
+		page := &site.Links[i]
+		for _, reference := range page.References {
+			target, _, _ := strings.Cut(reference, "#")
+			if target == filepath.ToSlash(page.FileName) {
+				continue
+			}
+			backlinks[target] = addPageReference(backlinks[target], pageReference(page))
+		}
+	}
+
+	for i := range site.Links {
+		page := &site.Links[i]
+		page.Backlinks = sortPageReferences(backlinks[filepath.ToSlash(page.FileName)])
+		page.EmbeddedBy = map[string][]d2s.PageReference{}
+		for _, diagram := range page.Diagrams {
+			others := []d2s.PageReference{}
+			for _, reference := range site.AllDiagrams[diagram] {
+				if reference.FileName != page.FileName {
+					others = append(others, reference)
+				}
+			}
+			if len(others) > 0 {
+				page.EmbeddedBy[diagram] = sortPageReferences(others)
+			}
+		}
+	}
+	for diagram := range site.AllDiagrams {
+		site.AllDiagrams[diagram] = sortPageReferences(site.AllDiagrams[diagram])
+	}
+}
+
+// sortPageReferences sorts the references by title so the output is stable
+func sortPageReferences(references []d2s.PageReference) []d2s.PageReference {
+	if references == nil {
+		return []d2s.PageReference{}
+	}
+	sort.SliceStable(references, func(i, j int) bool {
+		return references[i].Title < references[j].Title
+	})
+	return references
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"testing"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestBuildReferences(t *testing.T) {
+	setupSite()
+	defer setupSite()
+
+	pages := []struct {
+		Name     string
+		Prefix   string
+		Markdown string
+	}{
+		{Name: "/index.html", Prefix: "/", Markdown: "# Home\n\n[Login](user_flows/login.md) and [[Login Flow#Step Two]] and [[#home]]\n\n{{sample}}\n"},
+		{Name: "/user_flows/login.html", Prefix: "/user_flows/", Markdown: "# Login Flow\n\n## Step Two\n\n{{sample}} {{sample}}\n"},
+		{Name: "/about.html", Prefix: "/", Markdown: "# About\n\nSee the [login](/user_flows/login.md)\n\n{{other}}\n"},
+	}
+	for _, page := range pages {
+		leaf, err := d2s.ParseMD([]byte(page.Markdown), page.Prefix, nil)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", page.Name, err)
+		}
+		leaf.FileName = page.Name
+		for _, diagram := range leaf.Diagrams {
+			site.AllDiagrams[diagram] = addPageReference(site.AllDiagrams[diagram], pageReference(leaf))
+		}
+		site.Links = append(site.Links, *leaf)
+	}
+	resolveLinks(&CommandOptions{})
+	buildReferences()
+
+	home, login, about := site.Links[0], site.Links[1], site.Links[2]
+	if len(home.Backlinks) != 0 {
+		t.Errorf("expected the link to itself to be skipped but found %v", home.Backlinks)
+	}
+	if len(login.Backlinks) != 2 || login.Backlinks[0].Title != "About" || login.Backlinks[1].Title != "Home" {
+		t.Errorf("expected the login page to have one backlink each from About and Home but found %v", login.Backlinks)
+	}
+	if len(about.Backlinks) != 0 {
+		t.Errorf("expected no backlinks for the about page but found %v", about.Backlinks)
+	}
+
+	if len(site.AllDiagrams["/user_flows/sample.svg"]) != 1 || len(site.AllDiagrams["/sample.svg"]) != 1 {
+		t.Errorf("expected each sample diagram to be embedded once but found %v", site.AllDiagrams)
+	}
+	if len(home.EmbeddedBy) != 0 || len(about.EmbeddedBy) != 0 {
+		t.Errorf("expected diagrams only on one page to have no other pages: %v %v", home.EmbeddedBy, about.EmbeddedBy)
+	}
+}
+
+func TestBuildReferencesSharedDiagram(t *testing.T) {
+	setupSite()
+	defer setupSite()
+
+	for _, name := range []string{"/b.html", "/a.html"} {
+		leaf := &d2s.LeafData{
+			Title:    name,
+			FileName: name,
+			Diagrams: []string{"/shared.svg"},
+		}
+		site.AllDiagrams["/shared.svg"] = addPageReference(site.AllDiagrams["/shared.svg"], pageReference(leaf))
+		site.Links = append(site.Links, *leaf)
+	}
+	buildReferences()
+
+	shared := site.AllDiagrams["/shared.svg"]
+	if len(shared) != 2 || shared[0].FileName != "/a.html" || shared[1].FileName != "/b.html" {
+		t.Errorf("expected both pages to be kept and sorted for the shared diagram but found %v", shared)
+	}
+	others := site.Links[0].EmbeddedBy["/shared.svg"]
+	if len(others) != 1 || others[0].FileName != "/a.html" {
+		t.Errorf("expected /b.html to list /a.html as also embedding the diagram but found %v", others)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"html/template"
 	"os"
 	"path/filepath"
+	"strings"
 
+	d2s "github.com/kevineaton/d2tosite/parser"
 	"github.com/urfave/cli"
 	"gopkg.in/yaml.v3"
 )
@@ -22,28 +24,124 @@ var tagTemplateEmbedString string
 //go:embed default_templates/diagram_index.html
 var diagramIndexTemplateEmbedString string
 
+//go:embed default_templates/decisions.html
+var decisionsTemplateEmbedString string
+
+//go:embed default_templates/diagram.html
+var diagramTemplateEmbedString string
+
+//go:embed default_templates/entity_index.html
+var entityIndexTemplateEmbedString string
+
+//go:embed default_templates/entity.html
+var entityTemplateEmbedString string
+
+//go:embed default_templates/i18n/en.yaml
+var stringsEmbedString string
+
+// the ways a diagram wider than the wide diagram width can be shown
+const (
+	wideDiagramsScroll = "scroll" // at full size, scrolling sideways in the column
+	wideDiagramsExpand = "expand" // shrunk to the column, with a link to open it at full size
+	wideDiagramsNone   = "none"   // shrunk to the column
+)
+
 // CommandOptions holds all of the options to pass in to the processors
 type CommandOptions struct {
-	ConfigFile                   string `json:"config" yaml:"config"` // if this is provided, it is set first THEN the rest will be used
-	D2Theme                      int64  `json:"d2_theme" yaml:"d2_theme"`
-	D2Layout                     string `json:"d2_layout" yaml:"d2_layout"`
-	InputDirectory               string `json:"input_directory" yaml:"input_directory"`
-	OutputDirectory              string `json:"output_directory" yaml:"output_directory"`
-	PageTemplateFile             string `json:"page_template" yaml:"page_template"`
-	DiagramIndexPageTemplateFile string `json:"index_template" yaml:"index_template"`
-	TagPageTemplateFile          string `json:"tag_template" yaml:"tag_template"`
-	CleanOutputDirectoryFirst    bool   `json:"clean" yaml:"clean"`
-	ContinueOnCompileErrors      bool   `json:"continue_errors" yaml:"continue_errors"`
+	ConfigFile                   string  `json:"config" yaml:"config"` // if this is provided, it is set first THEN the rest will be used
+	D2Theme                      D2Theme `json:"d2_theme" yaml:"d2_theme"`
+	D2Layout                     string  `json:"d2_layout" yaml:"d2_layout"`
+	D2Pad                        int     `json:"d2_pad" yaml:"d2_pad"`
+	D2DisableFonts               bool    `json:"d2_disable_fonts" yaml:"d2_disable_fonts"`
+	D2DarkTheme                  D2Theme `json:"d2_dark_theme" yaml:"d2_dark_theme"`
+	D2JSON                       bool    `json:"d2_json" yaml:"d2_json"`
+	D2Source                     bool    `json:"d2_source" yaml:"d2_source"`
+	InputDirectory               string  `json:"input_directory" yaml:"input_directory"`
+	OutputDirectory              string  `json:"output_directory" yaml:"output_directory"`
+	PageTemplateFile             string  `json:"page_template" yaml:"page_template"`
+	DiagramIndexPageTemplateFile string  `json:"index_template" yaml:"index_template"`
+	TagPageTemplateFile          string  `json:"tag_template" yaml:"tag_template"`
+	DecisionsPageTemplateFile    string  `json:"decisions_template" yaml:"decisions_template"`
+	DiagramPageTemplateFile      string  `json:"diagram_template" yaml:"diagram_template"`
+	EntityIndexPageTemplateFile  string  `json:"entity_index_template" yaml:"entity_index_template"`
+	EntityPageTemplateFile       string  `json:"entity_template" yaml:"entity_template"`
+	CleanOutputDirectoryFirst    bool    `json:"clean" yaml:"clean"`
+	ContinueOnCompileErrors      bool    `json:"continue_errors" yaml:"continue_errors"`
+	InlineDiagrams               bool    `json:"inline_diagrams" yaml:"inline_diagrams"`
+	IncludeDrafts                bool    `json:"drafts" yaml:"drafts"`
+	IncludeFuture                bool    `json:"future" yaml:"future"`
+	TOCMinLevel                  int     `json:"toc_min_level" yaml:"toc_min_level"`
+	TOCMaxLevel                  int     `json:"toc_max_level" yaml:"toc_max_level"`
+	CodeStyle                    string  `json:"code_style" yaml:"code_style"`
+	CodeDarkStyle                string  `json:"code_dark_style" yaml:"code_dark_style"`
+	CodeLineNumbers              bool    `json:"code_line_numbers" yaml:"code_line_numbers"`
+	CodeClasses                  bool    `json:"code_classes" yaml:"code_classes"`
+	StrictLinks                  bool    `json:"strict_links" yaml:"strict_links"`
+	ShortcodesDirectory          string  `json:"shortcodes_directory" yaml:"shortcodes_directory"`
+	DataDirectory                string  `json:"data_directory" yaml:"data_directory"`
+	DefaultLanguage              string  `json:"default_language" yaml:"default_language"`
+	I18nDirectory                string  `json:"i18n_directory" yaml:"i18n_directory"`
+	WideDiagramWidth             int     `json:"wide_diagram_width" yaml:"wide_diagram_width"`
+	WideDiagrams                 string  `json:"wide_diagrams" yaml:"wide_diagrams"`
+	BaseURL                      string  `json:"base_url" yaml:"base_url"`
+
+	Markdown   MarkdownConfig             `json:"markdown" yaml:"markdown"`     // only available in the config file
+	Converters map[string]ConverterConfig `json:"converters" yaml:"converters"` // only available in the config file, keyed by extension
+	Languages  map[string]LanguageConfig  `json:"languages" yaml:"languages"`   // only available in the config file, keyed by language code
 
 	// the below are needed post-processing
 	PageTemplate             *template.Template
 	DiagramIndexPageTemplate *template.Template
 	TagPageTemplate          *template.Template
+	DecisionsPageTemplate    *template.Template
+	DiagramPageTemplate      *template.Template
+	EntityIndexPageTemplate  *template.Template
+	EntityPageTemplate       *template.Template
+	Shortcodes               map[string]*template.Template
+	Data                     map[string]interface{}
+}
+
+// MarkdownConfig is the markdown section of the config file. The extensions are all on unless
+// set to false, so they are pointers to tell if they were provided
+type MarkdownConfig struct {
+	Tables         *bool    `json:"tables" yaml:"tables"`
+	Strikethrough  *bool    `json:"strikethrough" yaml:"strikethrough"`
+	TaskList       *bool    `json:"task_list" yaml:"task_list"`
+	Linkify        *bool    `json:"linkify" yaml:"linkify"`
+	Footnotes      *bool    `json:"footnotes" yaml:"footnotes"`
+	DefinitionList *bool    `json:"definition_list" yaml:"definition_list"`
+	Typographer    *bool    `json:"typographer" yaml:"typographer"`
+	Math           *bool    `json:"math" yaml:"math"`
+	Admonitions    []string `json:"admonitions" yaml:"admonitions"`
+	HardWraps      bool     `json:"hard_wraps" yaml:"hard_wraps"`
+	Unsafe         bool     `json:"unsafe" yaml:"unsafe"`
+	XHTML          bool     `json:"xhtml" yaml:"xhtml"`
+}
+
+// apply copies the config onto the parser's options
+func (config MarkdownConfig) apply(options *d2s.MarkdownOptions) {
+	disabled := func(enabled *bool) bool {
+		return enabled != nil && !*enabled
+	}
+	options.DisableTables = disabled(config.Tables)
+	options.DisableStrikethrough = disabled(config.Strikethrough)
+	options.DisableTaskList = disabled(config.TaskList)
+	options.DisableLinkify = disabled(config.Linkify)
+	options.DisableFootnotes = disabled(config.Footnotes)
+	options.DisableDefinitionList = disabled(config.DefinitionList)
+	options.DisableTypographer = disabled(config.Typographer)
+	options.DisableMath = disabled(config.Math)
+	options.HardWraps = config.HardWraps
+	options.Unsafe = config.Unsafe
+	options.XHTML = config.XHTML
+	options.AdmonitionTypes = config.Admonitions
 }
 
 // Run is the main entrypoint for the binary. It takes various options and then works through the process
 func Run() error {
-	options := &CommandOptions{}
+	options := &CommandOptions{
+		D2Theme: 1,
+	}
 	app := &cli.App{
 		Name:        "d2tosite",
 		Description: "A simple CLI that traverses a directory and generates a basic HTML site from Markdown and D2 files",
@@ -54,11 +152,10 @@ func Run() error {
 				Usage:       "a config file that can be used to configure the build; if other flags are sent as well, they will override the file",
 				Destination: &options.ConfigFile,
 			},
-			&cli.Int64Flag{
-				Name:        "d2-theme",
-				Value:       1,
-				Usage:       "the D2 theme ID to use",
-				Destination: &options.D2Theme,
+			&cli.GenericFlag{
+				Name:  "d2-theme",
+				Value: &options.D2Theme,
+				Usage: "the D2 theme to use, by ID or by name such as 'grape-soda'",
 			},
 			&cli.StringFlag{
 				Name:        "d2-layout",
@@ -66,6 +163,32 @@ func Run() error {
 				Usage:       "the layout enginer to use for D2; can be 'dagre' or 'elk'",
 				Destination: &options.D2Layout,
 			},
+			&cli.IntFlag{
+				Name:        "d2-pad",
+				Value:       100,
+				Usage:       "the padding around each diagram in pixels; -1 removes it",
+				Destination: &options.D2Pad,
+			},
+			&cli.GenericFlag{
+				Name:  "d2-dark-theme",
+				Value: &options.D2DarkTheme,
+				Usage: "if set, each D2 diagram is also rendered with this theme, such as 'dark-mauve', and shown when the page's data-bs-theme is dark",
+			},
+			&cli.BoolFlag{
+				Name:        "d2-disable-fonts",
+				Usage:       "if true, the fonts aren't embedded in each diagram, which makes them much smaller but uses the reader's sans-serif font",
+				Destination: &options.D2DisableFonts,
+			},
+			&cli.BoolFlag{
+				Name:        "d2-json",
+				Usage:       "if true, the compiled model of each D2 diagram is written next to it as JSON, such as flow.d2.json",
+				Destination: &options.D2JSON,
+			},
+			&cli.BoolFlag{
+				Name:        "d2-source",
+				Usage:       "if true, the source of each diagram is copied next to it for its page, and D2 is shown below each embed, unless a page hides it with d2_source: false or {{name nosource}}",
+				Destination: &options.D2Source,
+			},
 			&cli.StringFlag{
 				Name:        "input-directory",
 				Value:       "./src",
@@ -96,6 +219,30 @@ func Run() error {
 				Usage:       "the template to use for each tag page content; if not provided, it will used the embedded template file at compile time",
 				Destination: &options.TagPageTemplateFile,
 			},
+			&cli.StringFlag{
+				Name:        "decisions-template",
+				Value:       "",
+				Usage:       "the template to use for the content of the decisions page; if not provided, it will used the embedded template file at compile time",
+				Destination: &options.DecisionsPageTemplateFile,
+			},
+			&cli.StringFlag{
+				Name:        "diagram-template",
+				Value:       "",
+				Usage:       "the template to use for the content of each diagram's page; if not provided, it will used the embedded template file at compile time",
+				Destination: &options.DiagramPageTemplateFile,
+			},
+			&cli.StringFlag{
+				Name:        "entity-index-template",
+				Value:       "",
+				Usage:       "the template to use for the content of the list of entities drawn in the diagrams; if not provided, it will used the embedded template file at compile time",
+				Destination: &options.EntityIndexPageTemplateFile,
+			},
+			&cli.StringFlag{
+				Name:        "entity-template",
+				Value:       "",
+				Usage:       "the template to use for the content of each entity's page; if not provided, it will used the embedded template file at compile time",
+				Destination: &options.EntityPageTemplateFile,
+			},
 			&cli.BoolFlag{
 				Name:        "clean",
 				Usage:       "if true, removes the target build directory prior to build",
@@ -106,6 +253,101 @@ func Run() error {
 				Usage:       "if true, continues to build site after parsing and compiling errors are found",
 				Destination: &options.ContinueOnCompileErrors,
 			},
+			&cli.BoolFlag{
+				Name:        "inline-diagrams",
+				Usage:       "if true, diagrams are inlined into the page as SVG instead of linked with an <img> tag; individual embeds can override with {{name inline}} or {{name img}}",
+				Destination: &options.InlineDiagrams,
+			},
+			&cli.BoolFlag{
+				Name:        "drafts",
+				Usage:       "if true, pages marked as a draft are included in the site with a banner",
+				Destination: &options.IncludeDrafts,
+			},
+			&cli.BoolFlag{
+				Name:        "future",
+				Usage:       "if true, pages with a publish_date in the future are included in the site with a banner",
+				Destination: &options.IncludeFuture,
+			},
+			&cli.IntFlag{
+				Name:        "toc-min-level",
+				Value:       2,
+				Usage:       "the smallest heading level to include in each page's table of contents",
+				Destination: &options.TOCMinLevel,
+			},
+			&cli.IntFlag{
+				Name:        "toc-max-level",
+				Value:       4,
+				Usage:       "the largest heading level to include in each page's table of contents",
+				Destination: &options.TOCMaxLevel,
+			},
+			&cli.StringFlag{
+				Name:        "code-style",
+				Value:       "github",
+				Usage:       "the chroma style to use when highlighting code blocks",
+				Destination: &options.CodeStyle,
+			},
+			&cli.StringFlag{
+				Name:        "code-dark-style",
+				Value:       "",
+				Usage:       "the chroma style to add to the code stylesheet for pages with data-bs-theme='dark'; only used with --code-classes",
+				Destination: &options.CodeDarkStyle,
+			},
+			&cli.BoolFlag{
+				Name:        "code-line-numbers",
+				Usage:       "if true, code blocks are rendered with line numbers",
+				Destination: &options.CodeLineNumbers,
+			},
+			&cli.BoolFlag{
+				Name:        "code-classes",
+				Usage:       "if true, code blocks are highlighted with CSS classes from the generated /highlight.css instead of inline styles",
+				Destination: &options.CodeClasses,
+			},
+			&cli.BoolFlag{
+				Name:        "strict-links",
+				Usage:       "if true, links to pages that can't be found are errors instead of warnings",
+				Destination: &options.StrictLinks,
+			},
+			&cli.StringFlag{
+				Name:        "shortcodes-directory",
+				Value:       "./shortcodes",
+				Usage:       "the directory of templates to use as shortcodes in the Markdown, named after each file",
+				Destination: &options.ShortcodesDirectory,
+			},
+			&cli.StringFlag{
+				Name:        "data-directory",
+				Value:       "./data",
+				Usage:       "the directory of .yaml, .json, and .toml files to load into the Data available to every template and shortcode",
+				Destination: &options.DataDirectory,
+			},
+			&cli.StringFlag{
+				Name:        "default-language",
+				Value:       "en",
+				Usage:       "the language code of pages without one in their name, which is published at the root of the site; other languages are set in the config file",
+				Destination: &options.DefaultLanguage,
+			},
+			&cli.StringFlag{
+				Name:        "i18n-directory",
+				Value:       "./i18n",
+				Usage:       "the directory of language files, such as de.yaml, with the text for the templates in each language",
+				Destination: &options.I18nDirectory,
+			},
+			&cli.IntFlag{
+				Name:        "wide-diagram-width",
+				Value:       1000,
+				Usage:       "diagrams wider than this many pixels are shown as set by --wide-diagrams instead of being shrunk to fit the page",
+				Destination: &options.WideDiagramWidth,
+			},
+			&cli.StringFlag{
+				Name:        "wide-diagrams",
+				Value:       wideDiagramsScroll,
+				Usage:       "how to show diagrams wider than --wide-diagram-width; can be 'scroll' to scroll them sideways, 'expand' to add a link to the full size diagram, or 'none'",
+				Destination: &options.WideDiagrams,
+			},
+			&cli.StringFlag{
+				Name:        "base-url",
+				Usage:       "the URL the site is served from, such as https://example.com/docs or /docs, which the site's links are put under; if not provided, the site is served from the root",
+				Destination: &options.BaseURL,
+			},
 		},
 		Action: func(context *cli.Context) error {
 			// check the arguments; if there's 2, then we override what is
@@ -144,6 +386,10 @@ func execute(options *CommandOptions) error {
 	if err != nil { // this will almost always be nil
 		return err
 	}
+	resolveLinks(options)
+	buildReferences()
+	buildEntities()
+	buildLanguages(options)
 	if len(traverseErrors) != 0 {
 		for i := range traverseErrors {
 			fmt.Printf("error: %+v\n", traverseErrors[i])
@@ -154,6 +400,10 @@ func execute(options *CommandOptions) error {
 			return errors.New("errors encountered, stopping")
 		}
 	}
+	err = buildCodeStylesheet(options)
+	if err != nil {
+		return err
+	}
 	err = processTemplates(options)
 	if err != nil {
 		return err
@@ -163,6 +413,18 @@ func execute(options *CommandOptions) error {
 		return err
 	}
 	err = buildDiagramIndexPage(options)
+	if err != nil {
+		return err
+	}
+	err = buildDiagramPages(options)
+	if err != nil {
+		return err
+	}
+	err = buildEntityPages(options)
+	if err != nil {
+		return err
+	}
+	err = buildDecisionsPage(options)
 	return err
 }
 
@@ -189,6 +451,24 @@ func parseConfiguration(options *CommandOptions) error {
 		if (options.D2Theme == 1 || options.D2Theme == 0) && fileOptions.D2Theme != 0 {
 			options.D2Theme = fileOptions.D2Theme
 		}
+		if (options.D2Layout == "dagre" || options.D2Layout == "") && fileOptions.D2Layout != "" {
+			options.D2Layout = fileOptions.D2Layout
+		}
+		if (options.D2Pad == 100 || options.D2Pad == 0) && fileOptions.D2Pad != 0 {
+			options.D2Pad = fileOptions.D2Pad
+		}
+		if !options.D2DisableFonts && fileOptions.D2DisableFonts {
+			options.D2DisableFonts = true
+		}
+		if options.D2DarkTheme == 0 && fileOptions.D2DarkTheme != 0 {
+			options.D2DarkTheme = fileOptions.D2DarkTheme
+		}
+		if !options.D2JSON && fileOptions.D2JSON {
+			options.D2JSON = true
+		}
+		if !options.D2Source && fileOptions.D2Source {
+			options.D2Source = true
+		}
 		if options.InputDirectory == "./src" && fileOptions.InputDirectory != "" {
 			options.InputDirectory = fileOptions.InputDirectory
 		}
@@ -204,12 +484,78 @@ func parseConfiguration(options *CommandOptions) error {
 		if options.TagPageTemplateFile == "" && fileOptions.TagPageTemplateFile != "" {
 			options.TagPageTemplateFile = fileOptions.TagPageTemplateFile
 		}
+		if options.DecisionsPageTemplateFile == "" && fileOptions.DecisionsPageTemplateFile != "" {
+			options.DecisionsPageTemplateFile = fileOptions.DecisionsPageTemplateFile
+		}
+		if options.DiagramPageTemplateFile == "" && fileOptions.DiagramPageTemplateFile != "" {
+			options.DiagramPageTemplateFile = fileOptions.DiagramPageTemplateFile
+		}
+		if options.EntityIndexPageTemplateFile == "" && fileOptions.EntityIndexPageTemplateFile != "" {
+			options.EntityIndexPageTemplateFile = fileOptions.EntityIndexPageTemplateFile
+		}
+		if options.EntityPageTemplateFile == "" && fileOptions.EntityPageTemplateFile != "" {
+			options.EntityPageTemplateFile = fileOptions.EntityPageTemplateFile
+		}
+		if options.BaseURL == "" && fileOptions.BaseURL != "" {
+			options.BaseURL = fileOptions.BaseURL
+		}
 		if !options.CleanOutputDirectoryFirst {
 			options.CleanOutputDirectoryFirst = fileOptions.CleanOutputDirectoryFirst
 		}
 		if !options.ContinueOnCompileErrors {
 			options.ContinueOnCompileErrors = fileOptions.ContinueOnCompileErrors
 		}
+		if !options.InlineDiagrams {
+			options.InlineDiagrams = fileOptions.InlineDiagrams
+		}
+		if !options.IncludeDrafts {
+			options.IncludeDrafts = fileOptions.IncludeDrafts
+		}
+		if !options.IncludeFuture {
+			options.IncludeFuture = fileOptions.IncludeFuture
+		}
+		if (options.TOCMinLevel == 2 || options.TOCMinLevel == 0) && fileOptions.TOCMinLevel != 0 {
+			options.TOCMinLevel = fileOptions.TOCMinLevel
+		}
+		if (options.TOCMaxLevel == 4 || options.TOCMaxLevel == 0) && fileOptions.TOCMaxLevel != 0 {
+			options.TOCMaxLevel = fileOptions.TOCMaxLevel
+		}
+		if (options.CodeStyle == "github" || options.CodeStyle == "") && fileOptions.CodeStyle != "" {
+			options.CodeStyle = fileOptions.CodeStyle
+		}
+		if options.CodeDarkStyle == "" && fileOptions.CodeDarkStyle != "" {
+			options.CodeDarkStyle = fileOptions.CodeDarkStyle
+		}
+		if !options.CodeLineNumbers {
+			options.CodeLineNumbers = fileOptions.CodeLineNumbers
+		}
+		if !options.CodeClasses {
+			options.CodeClasses = fileOptions.CodeClasses
+		}
+		if !options.StrictLinks {
+			options.StrictLinks = fileOptions.StrictLinks
+		}
+		if (options.ShortcodesDirectory == "./shortcodes" || options.ShortcodesDirectory == "") && fileOptions.ShortcodesDirectory != "" {
+			options.ShortcodesDirectory = fileOptions.ShortcodesDirectory
+		}
+		if (options.DataDirectory == "./data" || options.DataDirectory == "") && fileOptions.DataDirectory != "" {
+			options.DataDirectory = fileOptions.DataDirectory
+		}
+		if (options.DefaultLanguage == "en" || options.DefaultLanguage == "") && fileOptions.DefaultLanguage != "" {
+			options.DefaultLanguage = fileOptions.DefaultLanguage
+		}
+		if (options.I18nDirectory == "./i18n" || options.I18nDirectory == "") && fileOptions.I18nDirectory != "" {
+			options.I18nDirectory = fileOptions.I18nDirectory
+		}
+		if (options.WideDiagramWidth == 1000 || options.WideDiagramWidth == 0) && fileOptions.WideDiagramWidth != 0 {
+			options.WideDiagramWidth = fileOptions.WideDiagramWidth
+		}
+		if (options.WideDiagrams == wideDiagramsScroll || options.WideDiagrams == "") && fileOptions.WideDiagrams != "" {
+			options.WideDiagrams = fileOptions.WideDiagrams
+		}
+		options.Markdown = fileOptions.Markdown
+		options.Converters = fileOptions.Converters
+		options.Languages = fileOptions.Languages
 
 	}
 	return nil
@@ -224,9 +570,65 @@ func validateOptions(options *CommandOptions) error {
 	if options.D2Theme == 0 {
 		options.D2Theme = 8
 	}
+	options.D2Layout = strings.ToLower(strings.TrimSpace(options.D2Layout))
 	if options.D2Layout != "dagre" && options.D2Layout != "elk" {
+		if options.D2Layout != "" {
+			fmt.Printf("error: D2 layout %s is not known, using dagre\n", options.D2Layout)
+		}
 		options.D2Layout = "dagre"
 	}
+	if options.CodeStyle != "" && !d2s.IsCodeStyle(options.CodeStyle) {
+		fmt.Printf("error: code style %s is not known, using %s\n", options.CodeStyle, d2s.DefaultCodeStyle)
+		options.CodeStyle = d2s.DefaultCodeStyle
+	}
+	if options.CodeDarkStyle != "" && !d2s.IsCodeStyle(options.CodeDarkStyle) {
+		fmt.Printf("error: code dark style %s is not known, it will not be used\n", options.CodeDarkStyle)
+		options.CodeDarkStyle = ""
+	}
+	switch options.WideDiagrams {
+	case wideDiagramsScroll, wideDiagramsExpand, wideDiagramsNone:
+	case "":
+		options.WideDiagrams = wideDiagramsScroll
+	default:
+		fmt.Printf("error: wide diagrams must be scroll, expand, or none but was %s, using %s\n", options.WideDiagrams, wideDiagramsScroll)
+		options.WideDiagrams = wideDiagramsScroll
+	}
+	if options.TOCMinLevel < 1 || options.TOCMinLevel > 6 {
+		options.TOCMinLevel = 2
+	}
+	if options.TOCMaxLevel < options.TOCMinLevel || options.TOCMaxLevel > 6 {
+		options.TOCMaxLevel = 4
+		if options.TOCMaxLevel < options.TOCMinLevel {
+			options.TOCMaxLevel = options.TOCMinLevel
+		}
+	}
+
+	options.Converters, err = validateConverters(options.Converters)
+	if err != nil {
+		return err
+	}
+	err = validateLanguages(options)
+	if err != nil {
+		return err
+	}
+	options.BaseURL, err = validateBaseURL(options.BaseURL)
+	if err != nil {
+		return err
+	}
+
+	if options.ShortcodesDirectory != "" {
+		options.Shortcodes, err = d2s.LoadShortcodes(options.ShortcodesDirectory)
+		if err != nil {
+			return err
+		}
+	}
+	options.Data = map[string]interface{}{}
+	if options.DataDirectory != "" {
+		options.Data, err = d2s.LoadData(options.DataDirectory)
+		if err != nil {
+			return err
+		}
+	}
 
 	// now we want to validate the templates; if one isn't provided
 	// we will use the embedded ones. Effectively, check if the template exists
@@ -301,6 +703,98 @@ func validateOptions(options *CommandOptions) error {
 		options.DiagramIndexPageTemplate = foundTemplate
 	}
 
+	// and the decisions page
+	if options.DecisionsPageTemplateFile != "" {
+		foundTemplate, err := template.ParseFiles(options.DecisionsPageTemplateFile)
+		if err != nil {
+			// we couldn't parse it, so show an error and load the template
+			fmt.Printf("error: could not find decisions template: %s\n", options.DecisionsPageTemplateFile)
+			// if we close on errors, close
+			if !options.ContinueOnCompileErrors {
+				return err
+			}
+		} else {
+			options.DecisionsPageTemplate = foundTemplate
+		}
+	}
+	// check if the template is nil from either not being provided a valid file OR the input was blank
+	if options.DecisionsPageTemplate == nil {
+		foundTemplate, err := template.New("decisionsTemplate").Parse(decisionsTemplateEmbedString)
+		if err != nil {
+			return err
+		}
+		options.DecisionsPageTemplate = foundTemplate
+	}
+
+	// and the page of each diagram
+	if options.DiagramPageTemplateFile != "" {
+		foundTemplate, err := template.ParseFiles(options.DiagramPageTemplateFile)
+		if err != nil {
+			// we couldn't parse it, so show an error and load the template
+			fmt.Printf("error: could not find diagram template: %s\n", options.DiagramPageTemplateFile)
+			// if we close on errors, close
+			if !options.ContinueOnCompileErrors {
+				return err
+			}
+		} else {
+			options.DiagramPageTemplate = foundTemplate
+		}
+	}
+	// check if the template is nil from either not being provided a valid file OR the input was blank
+	if options.DiagramPageTemplate == nil {
+		foundTemplate, err := template.New("diagramTemplate").Parse(diagramTemplateEmbedString)
+		if err != nil {
+			return err
+		}
+		options.DiagramPageTemplate = foundTemplate
+	}
+
+	// the list of entities
+	if options.EntityIndexPageTemplateFile != "" {
+		foundTemplate, err := template.ParseFiles(options.EntityIndexPageTemplateFile)
+		if err != nil {
+			// we couldn't parse it, so show an error and load the template
+			fmt.Printf("error: could not find entity index template: %s\n", options.EntityIndexPageTemplateFile)
+			// if we close on errors, close
+			if !options.ContinueOnCompileErrors {
+				return err
+			}
+		} else {
+			options.EntityIndexPageTemplate = foundTemplate
+		}
+	}
+	// check if the template is nil from either not being provided a valid file OR the input was blank
+	if options.EntityIndexPageTemplate == nil {
+		foundTemplate, err := template.New("entityIndexTemplate").Parse(entityIndexTemplateEmbedString)
+		if err != nil {
+			return err
+		}
+		options.EntityIndexPageTemplate = foundTemplate
+	}
+
+	// and the page of each entity
+	if options.EntityPageTemplateFile != "" {
+		foundTemplate, err := template.ParseFiles(options.EntityPageTemplateFile)
+		if err != nil {
+			// we couldn't parse it, so show an error and load the template
+			fmt.Printf("error: could not find entity template: %s\n", options.EntityPageTemplateFile)
+			// if we close on errors, close
+			if !options.ContinueOnCompileErrors {
+				return err
+			}
+		} else {
+			options.EntityPageTemplate = foundTemplate
+		}
+	}
+	// check if the template is nil from either not being provided a valid file OR the input was blank
+	if options.EntityPageTemplate == nil {
+		foundTemplate, err := template.New("entityTemplate").Parse(entityTemplateEmbedString)
+		if err != nil {
+			return err
+		}
+		options.EntityPageTemplate = foundTemplate
+	}
+
 	// now we need to stat the input
 	if _, err := os.Stat(options.InputDirectory); os.IsNotExist(err) {
 		return fmt.Errorf("input directory %s does not exist, terminating", options.InputDirectory)
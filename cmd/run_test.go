@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
 )
 
 func TestValidateOptions(t *testing.T) {
@@ -109,3 +112,89 @@ func TestParseConfigFile(t *testing.T) {
 	}
 
 }
+
+func TestMarkdownConfig(t *testing.T) {
+	r := rand.Int63()
+	testDir := fmt.Sprintf("./test_data/%d", r)
+	err := os.MkdirAll(testDir, os.ModePerm)
+	if err != nil {
+		t.Fatalf("could not create filesystem: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	yamlFilePath := fmt.Sprintf("%s/%d_config.yaml", testDir, r)
+	err = os.WriteFile(yamlFilePath, []byte("markdown:\n  tables: false\n  typographer: true\n  hard_wraps: true\n  unsafe: true\n  admonitions: [note, risk]\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not create yaml file: %v", err)
+	}
+
+	options := &CommandOptions{
+		ConfigFile: yamlFilePath,
+	}
+	err = parseConfiguration(options)
+	if err != nil {
+		t.Fatalf("error parsing %s: %v", options.ConfigFile, err)
+	}
+
+	markdownOptions := &d2s.MarkdownOptions{}
+	options.Markdown.apply(markdownOptions)
+	if !markdownOptions.DisableTables {
+		t.Errorf("expected tables to be disabled")
+	}
+	if markdownOptions.DisableTypographer || markdownOptions.DisableFootnotes {
+		t.Errorf("expected extensions set to true or left out to stay enabled")
+	}
+	if !markdownOptions.HardWraps || !markdownOptions.Unsafe || markdownOptions.XHTML {
+		t.Errorf("expected the renderer options to be copied: %+v", markdownOptions)
+	}
+	if strings.Join(markdownOptions.AdmonitionTypes, ",") != "note,risk" {
+		t.Errorf("expected the admonition types to be copied: %v", markdownOptions.AdmonitionTypes)
+	}
+}
+
+func TestParseConfigFileD2Options(t *testing.T) {
+	testDir := t.TempDir()
+	for name, contents := range map[string]string{
+		"config.yaml": "d2_theme: Grape Soda\nd2_layout: elk\nd2_pad: 20\nd2_disable_fonts: true\nd2_dark_theme: dark-mauve\nd2_json: true\nd2_source: true\n",
+		"config.json": `{"d2_theme": "buttered-toast", "d2_layout": "elk", "d2_pad": -1, "d2_disable_fonts": true}`,
+	} {
+		err := os.WriteFile(testDir+"/"+name, []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+	}
+
+	for name, expected := range map[string]CommandOptions{
+		"config.yaml": {D2Theme: 6, D2Layout: "elk", D2Pad: 20, D2DisableFonts: true, D2DarkTheme: 200, D2JSON: true, D2Source: true},
+		"config.json": {D2Theme: 105, D2Layout: "elk", D2Pad: -1, D2DisableFonts: true},
+	} {
+		// the options start with the command line defaults
+		options := &CommandOptions{
+			ConfigFile: testDir + "/" + name,
+			D2Theme:    1,
+			D2Layout:   "dagre",
+			D2Pad:      100,
+		}
+		err := parseConfiguration(options)
+		if err != nil {
+			t.Errorf("%s: could not parse: %v", name, err)
+			continue
+		}
+		if options.D2Theme != expected.D2Theme || options.D2Layout != expected.D2Layout || options.D2Pad != expected.D2Pad || options.D2DisableFonts != expected.D2DisableFonts || options.D2DarkTheme != expected.D2DarkTheme || options.D2JSON != expected.D2JSON || options.D2Source != expected.D2Source {
+			t.Errorf("%s: expected the D2 options to be copied but found %+v", name, options)
+		}
+	}
+
+	err := os.WriteFile(testDir+"/bad.yaml", []byte("d2_theme: lemonade\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not write the bad config: %v", err)
+	}
+	if err := parseConfiguration(&CommandOptions{ConfigFile: testDir + "/bad.yaml"}); err == nil {
+		t.Errorf("expected an unknown theme to be an error")
+	}
+
+	// the flag takes the theme the same way
+	var theme D2Theme
+	if err := theme.Set("grape-soda"); err != nil || theme != 6 || theme.String() != "6" {
+		t.Errorf("expected the flag to find the theme by name but found %d, %v", theme, err)
+	}
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// directoryConfigFile is the name of the file that can be placed in any directory to
+// override settings for that directory and everything below it
+const directoryConfigFile = "_config.yaml"
+
+// d2DirectiveRegex finds the leading comment in a D2 file that sets options for just that file,
+// such as `# d2tosite: d2_layout=elk d2_theme=3` or `d2_theme=grape-soda`
+var d2DirectiveRegex = regexp.MustCompile(`^#\s*d2tosite:\s*(.*)$`)
+
+// diagramSettings are the D2 settings that can be overridden for part of the site; the zero
+// values mean that the setting was not provided and should be inherited. The theme is a pointer
+// since 0 is D2's Neutral default theme.
+type diagramSettings struct {
+	D2Theme  *D2Theme `json:"d2_theme" yaml:"d2_theme"`
+	D2Layout string   `json:"d2_layout" yaml:"d2_layout"`
+}
+
+// D2Theme is a D2 theme ID that can also be given by the theme's name, such as Grape Soda,
+// on the command line and in the config files
+type D2Theme int64
+
+// Set finds the theme from its ID or name, so it can be used as a flag
+func (theme *D2Theme) Set(value string) error {
+	id, err := d2s.D2ThemeID(value)
+	if err != nil {
+		return err
+	}
+	*theme = D2Theme(id)
+	return nil
+}
+
+// String shows the ID, for the flag's default; a theme that isn't set shows nothing
+func (theme *D2Theme) String() string {
+	if *theme == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(*theme), 10)
+}
+
+// UnmarshalJSON reads the theme as either a number or a string
+func (theme *D2Theme) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		return theme.Set(name)
+	}
+	return theme.Set(string(data))
+}
+
+// UnmarshalYAML reads the theme as either a number or a string
+func (theme *D2Theme) UnmarshalYAML(node *yaml.Node) error {
+	return theme.Set(node.Value)
+}
+
+// apply copies any provided settings onto the parse options
+func (settings diagramSettings) apply(options *d2s.ParseOptions) {
+	if settings.D2Theme != nil {
+		options.D2Theme = int64(*settings.D2Theme)
+	}
+	if settings.D2Layout != "" {
+		options.D2Layout = settings.D2Layout
+	}
+}
+
+// isEmpty checks if nothing was provided
+func (settings diagramSettings) isEmpty() bool {
+	return settings.D2Theme == nil && settings.D2Layout == ""
+}
+
+// equals checks if both provide the same settings, comparing the themes rather than the pointers
+func (settings diagramSettings) equals(other diagramSettings) bool {
+	if (settings.D2Theme == nil) != (other.D2Theme == nil) {
+		return false
+	}
+	if settings.D2Theme != nil && *settings.D2Theme != *other.D2Theme {
+		return false
+	}
+	return settings.D2Layout == other.D2Layout
+}
+
+// readDirectoryConfig reads the directory config in the directory, if there is one
+func readDirectoryConfig(directory string) (*diagramSettings, error) {
+	configFile := filepath.Join(directory, directoryConfigFile)
+	contents, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings := &diagramSettings{}
+	err = yaml.Unmarshal(contents, settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", configFile, err)
+	}
+	if settings.D2Layout != "" {
+		settings.D2Layout, err = d2s.D2LayoutName(settings.D2Layout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: d2_layout: %v", configFile, err)
+		}
+	}
+	return settings, nil
+}
+
+// resolveDirectorySettings applies the directory configs from the root down to the directory
+// holding the file, so the closest config wins
+func resolveDirectorySettings(path string, configs map[string]*diagramSettings, options *d2s.ParseOptions) {
+	directories := []string{"."}
+	dir := filepath.Dir(path)
+	if dir != "." {
+		parts := strings.Split(filepath.ToSlash(dir), "/")
+		for i := range parts {
+			directories = append(directories, filepath.Join(parts[:i+1]...))
+		}
+	}
+	for _, directory := range directories {
+		if settings, found := configs[directory]; found && settings != nil {
+			settings.apply(options)
+		}
+	}
+}
+
+// parseD2Directives reads the leading comments of a D2 file for a d2tosite directive
+// with space separated key=value pairs
+func parseD2Directives(content []byte) (diagramSettings, error) {
+	settings := diagramSettings{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			// only the leading comments are checked
+			break
+		}
+		found := d2DirectiveRegex.FindStringSubmatch(line)
+		if len(found) == 0 {
+			continue
+		}
+		for _, pair := range strings.Fields(found[1]) {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return settings, fmt.Errorf("d2tosite directive '%s' must be in the form key=value", pair)
+			}
+			switch key {
+			case "d2_theme":
+				theme := D2Theme(0)
+				err := theme.Set(value)
+				if err != nil {
+					return settings, fmt.Errorf("d2tosite directive d2_theme must be a theme ID or name, such as grape-soda: %v", err)
+				}
+				settings.D2Theme = &theme
+			case "d2_layout":
+				layout, err := d2s.D2LayoutName(value)
+				if err != nil {
+					return settings, fmt.Errorf("d2tosite directive d2_layout: %v", err)
+				}
+				settings.D2Layout = layout
+			default:
+				return settings, fmt.Errorf("d2tosite directive '%s' is not supported", key)
+			}
+		}
+	}
+	return settings, nil
+}
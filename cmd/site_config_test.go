@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestParseD2Directives(t *testing.T) {
+	tests := []struct {
+		Input         string
+		Expected      diagramSettings
+		ExpectAnError bool
+	}{
+		{
+			Input:    "a -> b",
+			Expected: diagramSettings{},
+		},
+		{
+			Input:    "# d2tosite: d2_layout=elk d2_theme=3\na -> b",
+			Expected: diagramSettings{D2Layout: "elk", D2Theme: themeSetting(3)},
+		},
+		{
+			Input:    "# just a comment\n\n#d2tosite: d2_theme=4\na -> b",
+			Expected: diagramSettings{D2Theme: themeSetting(4)},
+		},
+		{
+			Input:    "a -> b\n# d2tosite: d2_theme=4",
+			Expected: diagramSettings{},
+		},
+		{
+			Input:    "# d2tosite: d2_theme=grape-soda\na -> b",
+			Expected: diagramSettings{D2Theme: themeSetting(6)},
+		},
+		{
+			Input:    "# d2tosite: d2_theme=0\na -> b",
+			Expected: diagramSettings{D2Theme: themeSetting(0)},
+		},
+		{
+			Input:         "# d2tosite: d2_theme=dark\na -> b",
+			ExpectAnError: true,
+		},
+		{
+			Input:         "# d2tosite: d2_theme=2\na -> b",
+			ExpectAnError: true,
+		},
+		{
+			Input:    "# d2tosite: d2_layout=ELK\na -> b",
+			Expected: diagramSettings{D2Layout: "elk"},
+		},
+		{
+			Input:         "# d2tosite: d2_layout=elkk\na -> b",
+			ExpectAnError: true,
+		},
+		{
+			Input:         "# d2tosite: padding=10\na -> b",
+			ExpectAnError: true,
+		},
+		{
+			Input:         "# d2tosite: elk\na -> b",
+			ExpectAnError: true,
+		},
+	}
+	for i, tt := range tests {
+		settings, err := parseD2Directives([]byte(tt.Input))
+		if tt.ExpectAnError {
+			if err == nil {
+				t.Errorf("index %d: expected an error but it was nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("index %d: unexpected error: %v", i, err)
+		}
+		if !settings.equals(tt.Expected) {
+			t.Errorf("index %d: expected %+v but found %+v", i, tt.Expected, settings)
+		}
+	}
+}
+
+// themeSetting is a theme override for the tables
+func themeSetting(id int64) *D2Theme {
+	theme := D2Theme(id)
+	return &theme
+}
+
+func TestResolveDirectorySettings(t *testing.T) {
+	configs := map[string]*diagramSettings{
+		".":     {D2Theme: themeSetting(3)},
+		"one":   {D2Layout: "elk"},
+		"one/2": {D2Theme: themeSetting(0)},
+		"other": nil,
+	}
+	tests := []struct {
+		Path     string
+		Expected d2s.ParseOptions
+	}{
+		{Path: "a.d2", Expected: d2s.ParseOptions{D2Theme: 3, D2Layout: "dagre"}},
+		{Path: "one/a.d2", Expected: d2s.ParseOptions{D2Theme: 3, D2Layout: "elk"}},
+		{Path: "one/2/a.d2", Expected: d2s.ParseOptions{D2Theme: 0, D2Layout: "elk"}},
+		{Path: "one/2/3/a.d2", Expected: d2s.ParseOptions{D2Theme: 0, D2Layout: "elk"}},
+		{Path: "other/a.d2", Expected: d2s.ParseOptions{D2Theme: 3, D2Layout: "dagre"}},
+	}
+	for i, tt := range tests {
+		options := d2s.ParseOptions{D2Theme: 1, D2Layout: "dagre"}
+		resolveDirectorySettings(tt.Path, configs, &options)
+		if options != tt.Expected {
+			t.Errorf("index %d: expected %+v but found %+v", i, tt.Expected, options)
+		}
+	}
+}
+
+func TestReadDirectoryConfig(t *testing.T) {
+	r := rand.Int63()
+	testDir := fmt.Sprintf("./test_data/config_%d", r)
+	err := os.MkdirAll(testDir, os.ModePerm)
+	if err != nil {
+		t.Fatalf("could not create filesystem: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	settings, err := readDirectoryConfig(testDir)
+	if err != nil || settings != nil {
+		t.Errorf("expected no settings and no error without a config but found %+v, %v", settings, err)
+	}
+
+	err = os.WriteFile(testDir+"/"+directoryConfigFile, []byte("d2_theme: 4\nd2_layout: elk\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+	settings, err = readDirectoryConfig(testDir)
+	if err != nil || settings == nil || settings.D2Theme == nil || *settings.D2Theme != 4 || settings.D2Layout != "elk" {
+		t.Errorf("expected the settings to be read but found %+v, %v", settings, err)
+	}
+
+	err = os.WriteFile(testDir+"/"+directoryConfigFile, []byte("d2_theme: Grape Soda\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+	settings, err = readDirectoryConfig(testDir)
+	if err != nil || settings == nil || settings.D2Theme == nil || *settings.D2Theme != 6 {
+		t.Errorf("expected the theme to be found by name but found %+v, %v", settings, err)
+	}
+
+	err = os.WriteFile(testDir+"/"+directoryConfigFile, []byte("d2_layout: elkk\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+	_, err = readDirectoryConfig(testDir)
+	if err == nil || !strings.Contains(err.Error(), directoryConfigFile) || !strings.Contains(err.Error(), "elkk") {
+		t.Errorf("expected an unknown layout to error with the config file but found %v", err)
+	}
+
+	err = os.WriteFile(testDir+"/"+directoryConfigFile, []byte("d2_theme: [\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+	_, err = readDirectoryConfig(testDir)
+	if err == nil {
+		t.Errorf("expected an invalid config to error")
+	}
+}
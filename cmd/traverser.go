@@ -4,22 +4,44 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	d2s "github.com/kevineaton/d2tosite/parser"
 )
 
 // SiteData is the main store of the site data
 type SiteData struct {
-	Title       string
-	Content     template.HTML
-	Links       []d2s.LeafData
-	Tags        []string
-	SiteTags    map[string][]d2s.LeafData
-	AllDiagrams map[string]*d2s.LeafData
+	Title        string
+	Content      template.HTML
+	Links        []d2s.LeafData
+	Tags         []string
+	SiteTags     map[string][]d2s.LeafData
+	AllDiagrams  map[string][]d2s.PageReference // every page that embeds each diagram
+	Decisions    []SiteDecision                 // every decision admonition, in the order the pages were walked
+	DiagramSizes map[string]d2s.DiagramSize     // the size of each compiled diagram, by the path it is embedded with
+	Diagrams     map[string]d2s.DiagramData     // each compiled diagram, by the path it is embedded with
+	Entities     []SiteEntity                   // everything drawn in the D2 diagrams, sorted by key
+	EntityLabels []SiteLabel                    // the labels of the entities, sorted by key
+	Data         map[string]interface{}         // the data files, from the data directory
+	Languages    []*LanguageSite                // the site in each language, starting with the default
+}
+
+// siteStrings is the site data given to the diagram index and decisions templates, along with the
+// text of the default language
+type siteStrings struct {
+	*SiteData
+	Strings map[string]string
+}
+
+// SiteDecision is a decision along with the page it was made on
+type SiteDecision struct {
+	d2s.Decision
+	Page d2s.PageReference
 }
 
 var site *SiteData
@@ -31,7 +53,14 @@ func setupSite() {
 	site.Links = []d2s.LeafData{}
 	site.Tags = []string{}
 	site.SiteTags = map[string][]d2s.LeafData{}
-	site.AllDiagrams = map[string]*d2s.LeafData{}
+	site.AllDiagrams = map[string][]d2s.PageReference{}
+	site.Decisions = []SiteDecision{}
+	site.DiagramSizes = map[string]d2s.DiagramSize{}
+	site.Diagrams = map[string]d2s.DiagramData{}
+	site.Entities = []SiteEntity{}
+	site.EntityLabels = []SiteLabel{}
+	site.Data = map[string]interface{}{}
+	site.Languages = []*LanguageSite{}
 }
 
 var traverseErrors = []error{}
@@ -41,11 +70,28 @@ func walkInputDirectory(options *CommandOptions) error {
 	if site == nil {
 		setupSite()
 	}
+	if options.Data != nil {
+		site.Data = options.Data
+	}
 	inputPath := options.InputDirectory
 	outputPath := options.OutputDirectory
 	parseOptions := &d2s.ParseOptions{
-		D2Theme: options.D2Theme,
+		D2Theme:        int64(options.D2Theme),
+		D2Layout:       options.D2Layout,
+		D2Pad:          options.D2Pad,
+		D2DisableFonts: options.D2DisableFonts,
 	}
+	markdownOptions := &d2s.MarkdownOptions{
+		TOCMinLevel:     options.TOCMinLevel,
+		TOCMaxLevel:     options.TOCMaxLevel,
+		CodeStyle:       options.CodeStyle,
+		CodeLineNumbers: options.CodeLineNumbers,
+		CodeClasses:     options.CodeClasses,
+		IncludeRoot:     inputPath,
+		Shortcodes:      options.Shortcodes,
+		Data:            options.Data,
+	}
+	options.Markdown.apply(markdownOptions)
 
 	fsys := os.DirFS(inputPath)
 	// first, make sure the output directory is created
@@ -53,11 +99,30 @@ func walkInputDirectory(options *CommandOptions) error {
 	if err != nil {
 		return err
 	}
+	// diagrams are compiled after the walk, once we know which pages are published,
+	// so that diagrams only used by drafts or scheduled pages can be left out
+	diagrams := []diagramJob{}
+	publishedDiagrams := map[string]bool{}
+	excludedDiagrams := map[string]bool{}
+	hiddenSources := map[string]bool{} // hidden by any page, even one that isn't published
+	// the settings for the diagrams come from the directory configs and the pages that embed them
+	directoryConfigs := map[string]*diagramSettings{}
+	pageSettings := map[string]diagramSettings{}
+	pageSettingsSource := map[string]string{}
+
 	fs.WalkDir(fsys, ".", func(path string, d os.DirEntry, walkErr error) error {
 
 		// errors are handled a bit differently here; since we want to continue traversing,
 		// we will compile all errors into the slice of errors and report on them after
 
+		if d.IsDir() {
+			settings, err := readDirectoryConfig(filepath.Join(inputPath, path))
+			if err != nil {
+				traverseErrors = append(traverseErrors, err)
+			}
+			directoryConfigs[path] = settings
+		}
+
 		if path == "." {
 			// we don't need this, so we skip
 			return nil
@@ -77,22 +142,78 @@ func walkInputDirectory(options *CommandOptions) error {
 		inputFile := filepath.Join(inputPath, path)
 		outputFile := filepath.Join(outputPath, path)
 
+		if filepath.Base(path) == directoryConfigFile {
+			// already read with the directory
+			return nil
+		}
+
 		switch filepath.Ext(path) {
 		case ".d2":
 			// if it's a d2 diagram, hand it off for compilation
 			outputFile = strings.TrimSuffix(outputFile, filepath.Ext(path))
 			outputFile += ".svg"
-			err := handleD2(inputFile, outputFile, parseOptions)
-			if err != nil {
-				traverseErrors = append(traverseErrors, fmt.Errorf("%s: %+v", outputFile, err))
-			}
+			diagrams = append(diagrams, diagramJob{
+				InputFile:  inputFile,
+				OutputFile: outputFile,
+				Path:       path,
+				SitePath:   "/" + filepath.ToSlash(strings.TrimSuffix(path, filepath.Ext(path))) + ".svg",
+			})
 			return nil
 		case ".md":
+			if strings.HasPrefix(filepath.Base(path), "_") {
+				// partials are only included into other pages
+				return nil
+			}
 			// if it's markdown, process it and prepare it for conversion
 			prefix := string(os.PathSeparator) + strings.TrimRight(path, filepath.Base(path))
-			leaf, err := handleMD(inputFile, prefix)
+			leaf, err := handleMD(inputFile, prefix, markdownOptions)
 			if err != nil {
-				traverseErrors = append(traverseErrors, fmt.Errorf("%s: %+v", outputFile, err))
+				// the error already names the source file, and a page that didn't parse isn't published
+				traverseErrors = append(traverseErrors, err)
+				return nil
+			}
+			language, untranslated := pageLanguage(path, options)
+			leaf.Language = language
+			leaf.LanguagePath = options.languagePath(language)
+			if untranslated != path {
+				// the language is left out of the published name, and a translation is published under the language's path
+				if leaf.Title == strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) {
+					leaf.Title = strings.TrimSuffix(filepath.Base(untranslated), filepath.Ext(untranslated))
+				}
+				leaf.FileName = filepath.FromSlash(leaf.LanguagePath) + prefix + strings.Replace(filepath.Base(untranslated), ".md", ".html", -1)
+			}
+			if options.isMultilingual() {
+				// translations are published under their language's path, so relative links are made absolute
+				leaf.Content = template.HTML(relocateLinks(string(leaf.Content), prefix))
+			}
+			for _, diagram := range leaf.HiddenSources {
+				hiddenSources[diagram] = true
+			}
+			if !shouldPublish(leaf, options) {
+				for _, diagram := range leaf.Diagrams {
+					excludedDiagrams[diagram] = true
+				}
+				return nil
+			}
+			embedSettings := diagramSettings{
+				D2Layout: leaf.FrontMatter.D2Layout,
+			}
+			if leaf.FrontMatter.D2Theme != nil {
+				theme := D2Theme(*leaf.FrontMatter.D2Theme)
+				embedSettings.D2Theme = &theme
+			}
+			for _, diagram := range leaf.Diagrams {
+				publishedDiagrams[diagram] = true
+				if embedSettings.isEmpty() {
+					continue
+				}
+				if existing, found := pageSettings[diagram]; found && !existing.equals(embedSettings) {
+					// a diagram is only compiled once, so it can't follow both pages
+					traverseErrors = append(traverseErrors, fmt.Errorf("%s: embeds %s with different D2 settings than %s", inputFile, diagram, pageSettingsSource[diagram]))
+					continue
+				}
+				pageSettings[diagram] = embedSettings
+				pageSettingsSource[diagram] = inputFile
 			}
 			site.Links = append(site.Links, *leaf)
 			for _, tag := range leaf.Tags {
@@ -100,9 +221,27 @@ func walkInputDirectory(options *CommandOptions) error {
 			}
 
 			for _, diagram := range leaf.Diagrams {
-				site.AllDiagrams[diagram] = leaf
+				site.AllDiagrams[diagram] = addPageReference(site.AllDiagrams[diagram], pageReference(leaf))
+			}
+			for _, decision := range leaf.Decisions {
+				site.Decisions = append(site.Decisions, SiteDecision{
+					Decision: decision,
+					Page:     pageReference(leaf),
+				})
 			}
 		default:
+			if converter, found := options.Converters[strings.ToLower(filepath.Ext(path))]; found {
+				// other diagram languages are converted by an external command, and embedded the same as D2
+				outputFile = strings.TrimSuffix(outputFile, filepath.Ext(path)) + ".svg"
+				diagrams = append(diagrams, diagramJob{
+					InputFile:  inputFile,
+					OutputFile: outputFile,
+					Path:       path,
+					SitePath:   "/" + filepath.ToSlash(strings.TrimSuffix(path, filepath.Ext(path))) + ".svg",
+					Converter:  &converter,
+				})
+				return nil
+			}
 			// we just want to copy the file
 			err := handleOther(inputFile, outputFile)
 			if err != nil {
@@ -112,61 +251,263 @@ func walkInputDirectory(options *CommandOptions) error {
 
 		return nil
 	})
+
+	sources := map[string]string{}
+	// the source shown with the embeds doesn't have line numbers, so the copy button copies it as is
+	sourceOptions := &d2s.MarkdownOptions{
+		CodeStyle:   options.CodeStyle,
+		CodeClasses: options.CodeClasses,
+	}
+	pages := map[string]*d2s.LeafData{}
+	for i := range site.Links {
+		pages[filepath.ToSlash(site.Links[i].FileName)] = &site.Links[i]
+	}
+	// the shapes may link to the other diagrams by their source, such as servers.d2
+	diagramPages := map[string]string{}
+	diagramOutputs := map[string]bool{}
+	for _, diagram := range diagrams {
+		if !excludedDiagrams[diagram.SitePath] || publishedDiagrams[diagram.SitePath] {
+			diagramPages["/"+filepath.ToSlash(diagram.Path)] = diagramPagePath(diagram.SitePath)
+			diagramOutputs[diagram.SitePath] = true
+			diagramOutputs[diagramPagePath(diagram.SitePath)] = true
+		}
+	}
+	for _, diagram := range diagrams {
+		if excludedDiagrams[diagram.SitePath] && !publishedDiagrams[diagram.SitePath] {
+			continue
+		}
+		if source, found := sources[diagram.SitePath]; found {
+			traverseErrors = append(traverseErrors, fmt.Errorf("%s: both %s and %s would be written to it", diagram.OutputFile, source, diagram.InputFile))
+			continue
+		}
+		sources[diagram.SitePath] = diagram.InputFile
+		hasDark := diagram.Converter == nil && options.D2DarkTheme != 0
+		if hasDark {
+			if source, found := sources[darkPath(diagram.SitePath)]; found {
+				traverseErrors = append(traverseErrors, fmt.Errorf("%s: both %s and the dark theme of %s would be written to it", darkPath(diagram.OutputFile), source, diagram.InputFile))
+				continue
+			}
+			sources[darkPath(diagram.SitePath)] = diagram.InputFile
+		}
+		hasJSON := diagram.Converter == nil && options.D2JSON
+		if hasJSON {
+			if source, found := sources[jsonPath(diagram.SitePath)]; found {
+				traverseErrors = append(traverseErrors, fmt.Errorf("%s: both %s and the model of %s would be written to it", jsonPath(diagram.OutputFile), source, diagram.InputFile))
+				continue
+			}
+			sources[jsonPath(diagram.SitePath)] = diagram.InputFile
+		}
+		data := &d2s.DiagramData{Labels: []string{}}
+		if diagram.Converter != nil {
+			start := time.Now()
+			err := handleConverter(diagram.InputFile, diagram.OutputFile, *diagram.Converter)
+			if err != nil {
+				traverseErrors = append(traverseErrors, fmt.Errorf("%s: %+v", diagram.InputFile, err))
+				continue
+			}
+			// the converters only give back an SVG, so there is nothing to count
+			data.Converter = diagram.Converter.Command
+			data.CompileDuration = time.Since(start)
+		} else {
+			// the settings cascade from the site, to the directories, to the page embedding it;
+			// the diagram file itself may still override them when it is compiled
+			diagramOptions := *parseOptions
+			resolveDirectorySettings(diagram.Path, directoryConfigs, &diagramOptions)
+			pageSettings[diagram.SitePath].apply(&diagramOptions)
+			diagramOptions.Links = &d2LinkResolver{
+				source:       "/" + filepath.ToSlash(diagram.Path),
+				pages:        pages,
+				diagramPages: diagramPages,
+				outputs:      diagramOutputs,
+				options:      options,
+			}
+			compiled, err := handleD2(diagram.InputFile, diagram.OutputFile, &diagramOptions, int64(options.D2DarkTheme))
+			if err != nil {
+				traverseErrors = append(traverseErrors, fmt.Errorf("%s: %+v", diagram.OutputFile, err))
+				continue
+			}
+			if hasJSON {
+				err = handleD2JSON(diagram.OutputFile, compiled)
+				if err != nil {
+					traverseErrors = append(traverseErrors, fmt.Errorf("%s: %+v", jsonPath(diagram.OutputFile), err))
+				} else {
+					compiled.JSONPath = jsonPath(diagram.SitePath)
+				}
+			}
+			data = compiled
+		}
+		data.Source = "/" + filepath.ToSlash(diagram.Path)
+		data.Path = diagram.SitePath
+		data.PagePath = diagramPagePath(diagram.SitePath)
+		if _, found := pages[data.PagePath]; found {
+			traverseErrors = append(traverseErrors, fmt.Errorf("%s: both the page and the page of the diagram %s would be written to it", data.PagePath, diagram.InputFile))
+			data.PagePath = ""
+		}
+		// with --d2-source, the source is published next to the diagram, to be downloaded from the diagram's
+		// page, and D2 is shown with the embeds; once a page hides it, it isn't published anywhere
+		if options.D2Source && !hiddenSources[diagram.SitePath] {
+			err := handleOther(diagram.InputFile, filepath.Join(options.OutputDirectory, diagram.Path))
+			if err != nil {
+				traverseErrors = append(traverseErrors, fmt.Errorf("%s: %+v", diagram.InputFile, err))
+			} else {
+				data.DownloadPath = data.Source
+				if source, err := os.ReadFile(diagram.InputFile); err == nil && diagram.Converter == nil {
+					data.Code = template.HTML(d2s.HighlightCode(string(source), "d2", sourceOptions))
+				}
+			}
+		}
+		if hasDark {
+			data.DarkPath = darkPath(diagram.SitePath)
+		}
+		// the size is read back from the output, so it is the same for D2 and the converters
+		if svg, err := os.ReadFile(diagram.OutputFile); err == nil {
+			if size, found := d2s.SVGSize(svg); found {
+				data.Size = size
+				site.DiagramSizes[diagram.SitePath] = size
+			}
+		}
+		site.Diagrams[diagram.SitePath] = *data
+	}
 	return nil
 }
 
+// diagramJob is a diagram found on the walk that is waiting to be compiled
+type diagramJob struct {
+	InputFile  string
+	OutputFile string
+	Path       string           // the path relative to the input directory
+	SitePath   string           // the path the diagram is embedded with in the pages
+	Converter  *ConverterConfig // the external command to convert it with, or nil for D2
+}
+
+// shouldPublish checks if a page should be part of the site; drafts and pages with a publish date
+// in the future are left out unless the options ask for them, in which case they are marked for the banner
+func shouldPublish(leaf *d2s.LeafData, options *CommandOptions) bool {
+	if leaf.FrontMatter.Draft && !options.IncludeDrafts {
+		return false
+	}
+	if !leaf.FrontMatter.PublishDate.IsZero() && leaf.FrontMatter.PublishDate.After(time.Now()) {
+		if !options.IncludeFuture {
+			return false
+		}
+		leaf.Scheduled = true
+	}
+	return true
+}
+
 // processTemplates handles taking the walked file system and changing
 // the site into a serials of templates
 func processTemplates(options *CommandOptions) error {
+	links := map[string][]d2s.LeafData{}
+	for _, language := range site.Languages {
+		links[language.Code] = searchableLinks(language.Links)
+	}
 	for i := range site.Links {
 		if site.Links[i].Title == "" {
 			continue
 		}
+		// translations are written under their language's directory, which the walk doesn't create
+		err := os.MkdirAll(filepath.Dir(options.OutputDirectory+"/"+site.Links[i].FileName), os.ModePerm)
+		if err != nil {
+			return err
+		}
 		output, err := os.Create(options.OutputDirectory + "/" + site.Links[i].FileName)
 		if err != nil {
 			return err
 		}
 		defer output.Close()
-		site.Links[i].Links = site.Links
-		site.Links[i].SiteTags = site.SiteTags
-		err = options.PageTemplate.Execute(output, site.Links[i])
+		language := site.languageSite(site.Links[i].Language)
+		site.Links[i].Links = links[language.Code]
+		site.Links[i].SiteTags = language.SiteTags
+		site.Links[i].Strings = language.Strings
+		site.Links[i].Data = site.Data
+		site.Links[i].DiagramData = []d2s.DiagramData{}
+		for _, diagram := range site.Links[i].Diagrams {
+			if data, found := site.Diagrams[diagram]; found {
+				site.Links[i].DiagramData = append(site.Links[i].DiagramData, data)
+			}
+		}
+		// the finished embeds only go on the page itself, otherwise the inlined diagrams would end up in the search index
+		page := site.Links[i]
+		page.Content = embedDiagrams(page.Content, site.Diagrams, page.Strings, options)
+		err = executePage(options, output, page)
+		if err != nil {
+			return err
+		}
+	}
+	// now build a default Search page for each language
+	for _, language := range site.Languages {
+		err := os.MkdirAll(options.OutputDirectory+language.Path, os.ModePerm)
+		if err != nil {
+			return err
+		}
+		output, err := os.Create(options.OutputDirectory + language.Path + "/search.html")
+		if err != nil {
+			return err
+		}
+		defer output.Close()
+		searchPage := &d2s.LeafData{
+			Title:        language.Strings["search"],
+			Content:      template.HTML("<h1>" + template.HTMLEscapeString(language.Strings["search_results"]) + "</h1>"),
+			Links:        links[language.Code],
+			SiteTags:     language.SiteTags,
+			Data:         site.Data,
+			Language:     language.Code,
+			LanguagePath: language.Path,
+			Strings:      language.Strings,
+		}
+		err = executePage(options, output, *searchPage)
 		if err != nil {
 			return err
 		}
 	}
-	// now build a default Search page
-	output, err := os.Create(options.OutputDirectory + "/search.html")
+	return nil
+}
+
+// buildCodeStylesheet writes the stylesheet for highlighted code; it is always written so
+// templates can link to it, but is only needed when highlighting with classes. A stylesheet
+// of the site's own in the input directory is copied like any other file and left alone.
+func buildCodeStylesheet(options *CommandOptions) error {
+	if _, err := os.Stat(filepath.Join(options.InputDirectory, "highlight.css")); err == nil {
+		return nil
+	}
+	css, err := d2s.CodeStyleCSS(options.CodeStyle, options.CodeDarkStyle, options.CodeLineNumbers)
 	if err != nil {
-		fmt.Printf("\nHere: %+v\n", err)
 		return err
 	}
-	defer output.Close()
-	searchPage := &d2s.LeafData{
-		Title:    "Search",
-		Content:  "<h1>Search Results</h1>",
-		Links:    site.Links,
-		SiteTags: site.SiteTags,
-	}
-	err = options.PageTemplate.Execute(output, searchPage)
-	return err
+	return os.WriteFile(filepath.Join(options.OutputDirectory, "highlight.css"), css, 0600)
 }
 
 // buildTagPages builds each tag page that lists all of the pages that have a tag
 func buildTagPages(options *CommandOptions) error {
-	// we need to crate a tag page for each tag with links to each leaf with that tag
+	// we need to crate a tag page for each tag with links to each leaf with that tag,
+	// in each language
+	for _, language := range site.Languages {
+		err := buildLanguageTagPages(options, language)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildLanguageTagPages builds the tag pages of one language under its path
+func buildLanguageTagPages(options *CommandOptions, language *LanguageSite) error {
 	// make sure the tags directory exists
-	err := os.MkdirAll(options.OutputDirectory+"/tags/", os.ModePerm)
+	tagsDirectory := options.OutputDirectory + language.Path + "/tags/"
+	err := os.MkdirAll(tagsDirectory, os.ModePerm)
 	if err != nil {
 		return err
 	}
-	for tag, leaves := range site.SiteTags {
+	links := searchableLinks(language.Links)
+	for tag, leaves := range language.SiteTags {
 		tagFileName := strings.ReplaceAll(tag, " ", "_")
-		// dir := options.OutputDirectory + "/tags/" + tag
-		// os.MkdirAll(dir, os.ModePerm)
 		var tagOutput bytes.Buffer
 		err := options.TagPageTemplate.Execute(&tagOutput, map[string]interface{}{
-			"Tag":    tag,
-			"Leaves": leaves,
+			"Tag":     tag,
+			"Leaves":  leaves,
+			"Data":    site.Data,
+			"Strings": language.Strings,
 		})
 		if err != nil {
 			fmt.Printf("tag template error: %+v\n", err)
@@ -174,17 +515,21 @@ func buildTagPages(options *CommandOptions) error {
 		}
 
 		temp := d2s.LeafData{
-			Title:    tag,
-			Content:  template.HTML(tagOutput.String()),
-			Links:    site.Links,
-			SiteTags: site.SiteTags,
+			Title:        tag,
+			Content:      template.HTML(tagOutput.String()),
+			Links:        links,
+			SiteTags:     language.SiteTags,
+			Data:         site.Data,
+			Language:     language.Code,
+			LanguagePath: language.Path,
+			Strings:      language.Strings,
 		}
-		output, err := os.Create(options.OutputDirectory + "/tags/" + tagFileName + ".html")
+		output, err := os.Create(tagsDirectory + tagFileName + ".html")
 		if err != nil {
 			return err
 		}
 		defer output.Close()
-		err = options.PageTemplate.Execute(output, temp)
+		err = executePage(options, output, temp)
 		if err != nil {
 			return err
 		}
@@ -192,27 +537,138 @@ func buildTagPages(options *CommandOptions) error {
 	return nil
 }
 
+// executePage renders the page into the page template, with the site's links under the base URL
+func executePage(options *CommandOptions, output io.Writer, page d2s.LeafData) error {
+	page.BaseURL = options.BaseURL
+	var rendered bytes.Buffer
+	err := options.PageTemplate.Execute(&rendered, page)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(output, applyBaseURL(rendered.String(), options.BaseURL))
+	return err
+}
+
 // buildDiagramIndexPage builds the index of all the diagrams
 func buildDiagramIndexPage(options *CommandOptions) error {
+	// the index is only published once, in the default language
+	language := site.Languages[0]
 	var diagramOutput bytes.Buffer
-	err := options.DiagramIndexPageTemplate.Execute(&diagramOutput, site)
+	err := options.DiagramIndexPageTemplate.Execute(&diagramOutput, siteStrings{SiteData: site, Strings: language.Strings})
 	if err != nil {
 		return err
 	}
 	temp := d2s.LeafData{
-		Title:    "Index",
+		Title:    language.Strings["index"],
 		Content:  template.HTML(diagramOutput.String()),
-		Links:    site.Links,
-		SiteTags: site.SiteTags,
+		Links:    searchableLinks(language.Links),
+		SiteTags: language.SiteTags,
+		Data:     site.Data,
+		Language: language.Code,
+		Strings:  language.Strings,
 	}
 	output, err := os.Create(options.OutputDirectory + "/diagram_index.html")
 	if err != nil {
 		return err
 	}
 	defer output.Close()
-	err = options.PageTemplate.Execute(output, temp)
+	err = executePage(options, output, temp)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// buildDiagramPages builds the page of each diagram, with a viewer, its details and source, and the pages it is on
+func buildDiagramPages(options *CommandOptions) error {
+	// like the index, the diagram pages are only published in the default language
+	language := site.Languages[0]
+	links := searchableLinks(language.Links)
+	markdownOptions := &d2s.MarkdownOptions{
+		CodeStyle:       options.CodeStyle,
+		CodeLineNumbers: options.CodeLineNumbers,
+		CodeClasses:     options.CodeClasses,
+	}
+	for _, diagram := range site.Diagrams {
+		if diagram.PagePath == "" {
+			continue
+		}
+		// a hidden source isn't shown on the page either
+		code := template.HTML("")
+		if diagram.DownloadPath != "" {
+			source, err := os.ReadFile(filepath.Join(options.OutputDirectory, diagram.DownloadPath))
+			if err != nil {
+				return err
+			}
+			// the converters are highlighted by their extension, if chroma knows the language
+			codeLanguage := "d2"
+			if diagram.Converter != "" {
+				codeLanguage = strings.TrimPrefix(filepath.Ext(diagram.Source), ".")
+			}
+			code = template.HTML(d2s.HighlightCode(string(source), codeLanguage, markdownOptions))
+		}
+		var diagramOutput bytes.Buffer
+		err := options.DiagramPageTemplate.Execute(&diagramOutput, map[string]interface{}{
+			"Diagram": diagram,
+			"Code":    code,
+			"Shapes":  diagramShapes(diagram),
+			"Pages":   site.AllDiagrams[diagram.Path],
+			"Data":    site.Data,
+			"Strings": language.Strings,
+		})
+		if err != nil {
+			return err
+		}
+		temp := d2s.LeafData{
+			Title:    strings.TrimPrefix(diagram.Source, "/"),
+			Content:  template.HTML(diagramOutput.String()),
+			Links:    links,
+			SiteTags: language.SiteTags,
+			Data:     site.Data,
+			Language: language.Code,
+			Strings:  language.Strings,
+		}
+		outputFile := filepath.Join(options.OutputDirectory, diagram.PagePath)
+		err = os.MkdirAll(filepath.Dir(outputFile), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		output, err := os.Create(outputFile)
+		if err != nil {
+			return err
+		}
+		// closed as each page is written, since a site can have many diagrams
+		err = executePage(options, output, temp)
+		output.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildDecisionsPage builds the list of every decision made across the site
+func buildDecisionsPage(options *CommandOptions) error {
+	// the index is only published once, in the default language
+	language := site.Languages[0]
+	var decisionsOutput bytes.Buffer
+	err := options.DecisionsPageTemplate.Execute(&decisionsOutput, siteStrings{SiteData: site, Strings: language.Strings})
+	if err != nil {
+		return err
+	}
+	temp := d2s.LeafData{
+		Title:    language.Strings["decisions"],
+		Content:  template.HTML(decisionsOutput.String()),
+		Links:    searchableLinks(language.Links),
+		SiteTags: language.SiteTags,
+		Data:     site.Data,
+		Language: language.Code,
+		Strings:  language.Strings,
+	}
+	output, err := os.Create(options.OutputDirectory + "/decisions.html")
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	return executePage(options, output, temp)
+}
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
+
+	d2s "github.com/kevineaton/d2tosite/parser"
 )
 
 func TestWalkDir(t *testing.T) {
@@ -58,3 +62,996 @@ func TestWalkDir(t *testing.T) {
 
 	os.RemoveAll(testPath)
 }
+
+func TestWalkDirDiagramData(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"login.d2": "a -> b",
+		"index.md": "---\ntitle: Test\n---\n\nHi!\n\n{{login}}\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	diagram, found := site.Diagrams["/login.svg"]
+	if !found || diagram.Size.Width == 0 {
+		t.Errorf("expected the size of the diagram to be recorded: %+v", site.Diagrams)
+	}
+	if size := site.DiagramSizes["/login.svg"]; size != diagram.Size {
+		t.Errorf("expected the size to still be in DiagramSizes: %+v", site.DiagramSizes)
+	}
+	if diagram.Source != "/login.d2" || diagram.Shapes != 2 || diagram.Connections != 1 || diagram.Layout != "dagre" {
+		t.Errorf("expected the diagram to be described: %+v", diagram)
+	}
+	page := site.Links[0]
+	if len(page.DiagramData) != 1 || page.DiagramData[0].Path != diagram.Path {
+		t.Errorf("expected the page to have the data of its diagram: %+v", page.DiagramData)
+	}
+	index, _ := os.ReadFile(testPath + "/build/diagram_index.html")
+	if !strings.Contains(string(index), "2 shapes, 1 connection<") {
+		t.Errorf("expected the index to show the diagram's stats: %s", index)
+	}
+}
+
+func TestWalkDirCodeStylesheet(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+	err = os.WriteFile(testPath+"/src/index.md", []byte("# Home\n\n```go\nfunc main() {}\n```\n"), 0600)
+	if err != nil {
+		t.Fatalf("tried to write test file but could not: %v", err)
+	}
+
+	setupSite()
+	defer setupSite()
+	options := &CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		CodeClasses:     true,
+	}
+	err = execute(options)
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	css, err := os.ReadFile(testPath + "/build/highlight.css")
+	if err != nil || !strings.Contains(string(css), ".chroma") {
+		t.Errorf("expected the code stylesheet to be written: %v %s", err, css)
+	}
+
+	// the site's own stylesheet isn't replaced
+	err = os.WriteFile(testPath+"/src/highlight.css", []byte("/* ours */\n"), 0600)
+	if err != nil {
+		t.Fatalf("tried to write test file but could not: %v", err)
+	}
+	setupSite()
+	err = execute(options)
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	css, _ = os.ReadFile(testPath + "/build/highlight.css")
+	if string(css) != "/* ours */\n" {
+		t.Errorf("expected the site's stylesheet to be kept but found %s", css)
+	}
+}
+
+func TestWalkDirDrafts(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"published.md":   "---\ntitle: Published\ntags: public\n---\n\n{{shared}}\n",
+		"draft.md":       "---\ntitle: Draft\ndraft: true\ntags: secret\n---\n\n{{shared}}\n\n{{draft_only}}\n",
+		"future.md":      "---\ntitle: Future\npublish_date: 2999-01-01\n---\n\n{{future_only}}\n",
+		"shared.d2":      "a -> b",
+		"draft_only.d2":  "c -> d",
+		"future_only.d2": "e -> f",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	options := &CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+	}
+	setupSite()
+	err = execute(options)
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	if len(site.Links) != 1 || site.Links[0].Title != "Published" {
+		t.Errorf("expected only the published page in the links but found %d", len(site.Links))
+	}
+	if _, found := site.SiteTags["secret"]; found {
+		t.Errorf("expected the draft tags to be left out")
+	}
+	for name, expected := range map[string]bool{
+		"published.html":  true,
+		"shared.svg":      true,
+		"draft.html":      false,
+		"draft_only.svg":  false,
+		"future.html":     false,
+		"future_only.svg": false,
+	} {
+		_, err := os.Stat(testPath + "/build/" + name)
+		if expected && err != nil {
+			t.Errorf("expected %s to be built", name)
+		}
+		if !expected && err == nil {
+			t.Errorf("expected %s to be left out", name)
+		}
+	}
+
+	// now include them and make sure they are marked
+	options.IncludeDrafts = true
+	options.IncludeFuture = true
+	setupSite()
+	err = execute(options)
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	if len(site.Links) != 3 {
+		t.Errorf("expected all of the pages in the links but found %d", len(site.Links))
+	}
+	for _, name := range []string{"draft.html", "draft_only.svg", "future.html", "future_only.svg"} {
+		if _, err := os.Stat(testPath + "/build/" + name); err != nil {
+			t.Errorf("expected %s to be built", name)
+		}
+	}
+	contents, _ := os.ReadFile(testPath + "/build/future.html")
+	if !strings.Contains(string(contents), "scheduled to be published on 2999-01-01") {
+		t.Errorf("expected the scheduled page to have a banner")
+	}
+	contents, _ = os.ReadFile(testPath + "/build/draft.html")
+	if !strings.Contains(string(contents), "This page is a draft") {
+		t.Errorf("expected the draft page to have a banner")
+	}
+	setupSite()
+}
+
+func TestWalkDirParseErrors(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"good.md":   "# Good\n",
+		"broken.md": "---\nweight: heavy\n---\n# Broken\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	traverseErrors = []error{}
+	defer func() {
+		traverseErrors = []error{}
+	}()
+	err = execute(&CommandOptions{
+		InputDirectory:          testPath + "/src",
+		OutputDirectory:         testPath + "/build",
+		ContinueOnCompileErrors: true,
+	})
+	if err != nil {
+		t.Fatalf("expected the build to continue past the broken page: %v", err)
+	}
+	if len(traverseErrors) != 1 || !strings.Contains(traverseErrors[0].Error(), "broken.md") {
+		t.Errorf("expected the broken page to be reported: %v", traverseErrors)
+	}
+	// a page that didn't parse isn't published half built
+	if len(site.Links) != 1 || site.Links[0].Title != "Good" {
+		t.Errorf("expected only the page that parsed to be published: %+v", site.Links)
+	}
+	if _, err := os.Stat(testPath + "/build/broken.html"); err == nil {
+		t.Errorf("expected the broken page not to be written")
+	}
+}
+
+func TestWalkDirDiagramSettings(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src/themed", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"plain.d2":                      "a -> b",
+		"page.d2":                       "a -> b",
+		"page.md":                       "---\ntitle: Page\nd2_theme: 4\n---\n\n{{page}}\n",
+		"directive.d2":                  "# d2tosite: d2_theme=4\na -> b",
+		"themed/" + directoryConfigFile: "d2_theme: 4\n",
+		"themed/dir.d2":                 "a -> b",
+		"neutral.d2":                    "a -> b",
+		"neutral.md":                    "---\ntitle: Neutral\nd2_theme: 0\n---\n\n{{neutral}}\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		D2Theme:         1,
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+
+	plain, _ := os.ReadFile(testPath + "/build/plain.svg")
+	themed, err := d2s.ParseD2([]byte("a -> b"), &d2s.ParseOptions{D2Theme: 4})
+	if err != nil {
+		t.Fatalf("could not compile the expected diagram: %v", err)
+	}
+	if string(plain) == string(themed) {
+		t.Fatalf("expected the themes to render differently")
+	}
+	for _, name := range []string{"page.svg", "directive.svg", "themed/dir.svg"} {
+		found, _ := os.ReadFile(testPath + "/build/" + name)
+		if string(found) != string(themed) {
+			t.Errorf("expected %s to use the overridden theme", name)
+		}
+	}
+	if _, err := os.Stat(testPath + "/build/themed/" + directoryConfigFile); err == nil {
+		t.Errorf("expected the directory config to not be copied")
+	}
+	// the neutral default theme is 0, which is still an override
+	neutral, err := d2s.ParseD2([]byte("a -> b"), &d2s.ParseOptions{D2Theme: 0})
+	if err != nil {
+		t.Fatalf("could not compile the expected diagram: %v", err)
+	}
+	if found, _ := os.ReadFile(testPath + "/build/neutral.svg"); string(found) != string(neutral) || string(found) == string(plain) {
+		t.Errorf("expected the page to set the neutral default theme")
+	}
+
+	// two pages can't compile the same diagram differently
+	err = os.WriteFile(testPath+"/src/other.md", []byte("---\ntitle: Other\nd2_layout: elk\n---\n\n{{page}}\n"), 0600)
+	if err != nil {
+		t.Fatalf("tried to write test file but could not: %v", err)
+	}
+	setupSite()
+	traverseErrors = []error{}
+	defer func() {
+		traverseErrors = []error{}
+	}()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		D2Theme:         1,
+	})
+	if err == nil || len(traverseErrors) != 1 || !strings.Contains(traverseErrors[0].Error(), "with different D2 settings") {
+		t.Errorf("expected the conflicting settings to be an error: %v %v", err, traverseErrors)
+	}
+}
+
+func TestWalkDirD2Options(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+	err = os.WriteFile(testPath+"/src/flow.d2", []byte("a -> b\na -> c\nb -> d"), 0600)
+	if err != nil {
+		t.Fatalf("tried to write test file but could not: %v", err)
+	}
+
+	builds := map[string]*CommandOptions{
+		"default": {D2Theme: 1},
+		"theme":   {D2Theme: 6},
+		"layout":  {D2Theme: 1, D2Layout: "elk"},
+		"pad":     {D2Theme: 1, D2Pad: -1},
+		"fonts":   {D2Theme: 1, D2DisableFonts: true},
+	}
+	rendered := map[string]string{}
+	for name, options := range builds {
+		setupSite()
+		options.InputDirectory = testPath + "/src"
+		options.OutputDirectory = testPath + "/build_" + name
+		err = execute(options)
+		if err != nil {
+			t.Fatalf("%s: tried to walk but could not: %v", name, err)
+		}
+		svg, _ := os.ReadFile(options.OutputDirectory + "/flow.svg")
+		rendered[name] = string(svg)
+		diagram := site.Diagrams["/flow.svg"]
+		if diagram.Theme != int64(options.D2Theme) || diagram.Layout != options.D2Layout {
+			t.Errorf("%s: expected the diagram to be compiled with the options but found %+v", name, diagram)
+		}
+	}
+	setupSite()
+	for name := range builds {
+		if name != "default" && rendered[name] == rendered["default"] {
+			t.Errorf("expected the %s option to change the rendered diagram", name)
+		}
+	}
+	if strings.Contains(rendered["fonts"], "@font-face") || !strings.Contains(rendered["default"], "@font-face") {
+		t.Errorf("expected the fonts to only be left out when disabled")
+	}
+}
+
+func TestWalkDirDarkTheme(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"flow.d2":    "a -> b",
+		"legacy.dot": "<svg width='10' height='10'></svg>",
+		"page.md":    "# Page\n\n{{flow}}\n\n{{legacy}}\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		D2Theme:         1,
+		D2DarkTheme:     200,
+		Converters:      map[string]ConverterConfig{".dot": {Command: "cat"}},
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+
+	light, _ := os.ReadFile(testPath + "/build/flow.svg")
+	dark, err := os.ReadFile(testPath + "/build/flow.dark.svg")
+	if err != nil || !strings.Contains(string(dark), "background: #1E1E2E;") || !strings.Contains(string(light), "background: white;") {
+		t.Errorf("expected both themes of the diagram to be written: %v", err)
+	}
+	if site.Diagrams["/flow.svg"].DarkPath != "/flow.dark.svg" || site.Diagrams["/legacy.svg"].DarkPath != "" {
+		t.Errorf("expected only the D2 diagram to have a dark theme: %+v", site.Diagrams)
+	}
+	if _, err := os.Stat(testPath + "/build/legacy.dark.svg"); err == nil {
+		t.Errorf("expected the converted diagram not to have a dark theme")
+	}
+	page, _ := os.ReadFile(testPath + "/build/page.html")
+	if !strings.Contains(string(page), "<img src='/flow.dark.svg' class='diagram-svg diagram-theme-dark'") || !strings.Contains(string(page), `[data-bs-theme="dark"] .diagram-theme-dark {`) {
+		t.Errorf("expected the page to switch the diagram to the dark theme: %s", page)
+	}
+	index, _ := os.ReadFile(testPath + "/build/diagram_index.html")
+	if !strings.Contains(string(index), `<a href="/flow.dark.svg" target="_/flow.dark.svg" class="diagram-index-link diagram-index-link-dark">dark</a>`) {
+		t.Errorf("expected the index to link the dark theme: %s", index)
+	}
+}
+
+func TestWalkDirJSON(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src/flows", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"flows/login.d2": "user -> api: signs in\napi.tooltip: The public API",
+		"legacy.dot":     "<svg width='10' height='10'></svg>",
+		"flows/page.md":  "# Page\n\n{{login}}\n",
+		"page.md":        "# Page\n\n{{legacy}}\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		D2JSON:          true,
+		Converters:      map[string]ConverterConfig{".dot": {Command: "cat"}},
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+
+	contents, err := os.ReadFile(testPath + "/build/flows/login.d2.json")
+	if err != nil {
+		t.Fatalf("expected the model to be written: %v", err)
+	}
+	model := d2s.DiagramModel{}
+	err = json.Unmarshal(contents, &model)
+	if err != nil {
+		t.Fatalf("expected the model to be valid JSON: %v", err)
+	}
+	if model.Diagram == nil || len(model.Diagram.Shapes) != 2 || len(model.Diagram.Connections) != 1 {
+		t.Errorf("expected the compiled diagram in the model: %s", contents)
+	}
+	if len(model.Graph.Connections) != 1 || model.Graph.Connections[0].Label != "signs in" {
+		t.Errorf("expected the connection in the graph summary: %+v", model.Graph)
+	}
+	if site.Diagrams["/flows/login.svg"].JSONPath != "/flows/login.d2.json" || site.Diagrams["/legacy.svg"].JSONPath != "" {
+		t.Errorf("expected only the D2 diagram to have a model: %+v", site.Diagrams)
+	}
+	if _, err := os.Stat(testPath + "/build/legacy.d2.json"); err == nil {
+		t.Errorf("expected the converted diagram not to have a model")
+	}
+	index, _ := os.ReadFile(testPath + "/build/diagram_index.html")
+	if !strings.Contains(string(index), `<a href="/flows/login.d2.json" target="_/flows/login.d2.json" class="diagram-index-link diagram-index-link-json">json</a>`) {
+		t.Errorf("expected the index to link the model: %s", index)
+	}
+}
+
+func TestWalkDirDiagramPages(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src/flows", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"flows/login.d2": "# signing in\nuser -> api: signs in\napi.shape: cylinder\n",
+		"flows/login.md": "---\ntitle: Login\n---\n\n{{login}}\n",
+		"flows/other.md": "---\ntitle: Other\n---\n\n{{login}}\n",
+		"legacy.dot":     "<svg width='10' height='10'></svg>",
+		"index.md":       "---\ntitle: Home\n---\n\n{{legacy}}\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		D2DarkTheme:     200,
+		D2Source:        true,
+		CodeClasses:     true,
+		Converters:      map[string]ConverterConfig{".dot": {Command: "cat"}},
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+
+	if data := site.Diagrams["/flows/login.svg"]; data.PagePath != "/diagrams/flows/login.html" || data.DownloadPath != "/flows/login.d2" {
+		t.Errorf("expected the diagram to have its page and the source next to it: %+v", data)
+	}
+	source, err := os.ReadFile(testPath + "/build/flows/login.d2")
+	if err != nil || string(source) != files["flows/login.d2"] {
+		t.Errorf("expected the source to be published for download: %v", err)
+	}
+	for page, expected := range map[string][]string{
+		"diagrams/flows/login.html": {
+			"<title>flows/login.d2</title>",
+			`<div class="diagram-viewer" id="diagram-viewer">`,
+			`data-viewer="fullscreen"`,
+			`<a href="/flows/login.svg" download`,
+			`<a href="/flows/login.d2" download`,
+			`<img src="/flows/login.dark.svg" alt="/flows/login.d2" draggable="false" class="diagram-theme-dark"`,
+			`<span class="c"># signing in</span>`,
+			`<span class="k">shape</span>`,
+			"<th>Layout</th><td>dagre</td>",
+			`<a href="/flows/login.html" class="diagram-page-embedded-in">Login</a>`,
+			`<a href="/flows/other.html" class="diagram-page-embedded-in">Other</a>`,
+		},
+		"diagrams/legacy.html": {
+			"<th>Converter</th><td><code>cat</code></td>",
+			`<a href="/legacy.dot" download`,
+			`<a href="/index.html" class="diagram-page-embedded-in">Home</a>`,
+		},
+		"flows/login.html":   {`<a href='/diagrams/flows/login.html' class='diagram-page-link'><img src='/flows/login.svg' class='diagram-svg diagram-theme-light'`},
+		"diagram_index.html": {`<a href="/diagrams/flows/login.html" class="diagram-index-link diagram-index-link-title">`},
+	} {
+		contents, err := os.ReadFile(testPath + "/build/" + page)
+		if err != nil {
+			t.Errorf("expected %s to be written: %v", page, err)
+			continue
+		}
+		for _, text := range expected {
+			if !strings.Contains(string(contents), text) {
+				t.Errorf("expected %s to contain %s but found %s", page, text, contents)
+			}
+		}
+	}
+	if contents, _ := os.ReadFile(testPath + "/build/diagrams/legacy.html"); strings.Contains(string(contents), "<th>Shapes</th>") {
+		t.Errorf("expected the converted diagram not to have any counts")
+	}
+
+	// a page can't be written where a diagram's page would be
+	err = os.MkdirAll(testPath+"/src/diagrams", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test dir but could not: %v", err)
+	}
+	err = os.WriteFile(testPath+"/src/diagrams/legacy.md", []byte("# Taken\n"), 0600)
+	if err != nil {
+		t.Fatalf("tried to write test file but could not: %v", err)
+	}
+	setupSite()
+	traverseErrors = []error{}
+	defer func() {
+		traverseErrors = []error{}
+	}()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		Converters:      map[string]ConverterConfig{".dot": {Command: "cat"}},
+	})
+	if err == nil || len(traverseErrors) != 1 || !strings.Contains(traverseErrors[0].Error(), "/diagrams/legacy.html") {
+		t.Errorf("expected the page and the diagram's page to collide: %v %v", err, traverseErrors)
+	}
+	if data := site.Diagrams["/flows/login.svg"]; data.DownloadPath != "" || data.Code != "" {
+		t.Errorf("expected the source to only be published with D2Source: %+v", data)
+	}
+	if _, err := os.Stat(testPath + "/build/diagrams/flows/login.d2"); err == nil {
+		t.Errorf("expected the source to only be published next to the diagram")
+	}
+}
+
+func TestWalkDirD2Source(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"flow.d2":    "a -> b: calls\n",
+		"secret.d2":  "vault -> keys\n",
+		"private.d2": "x -> y\n",
+		"index.md":   "# Home\n\n{{flow}}\n\n{{secret nosource}}\n",
+		"other.md":   "# Other\n\n{{secret}}\n",
+		"hidden.md":  "---\nd2_source: false\n---\n# Hidden\n\n{{private}}\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		D2Source:        true,
+		CodeClasses:     true,
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+
+	source, err := os.ReadFile(testPath + "/build/flow.d2")
+	if err != nil || string(source) != files["flow.d2"] {
+		t.Errorf("expected the source to be copied next to the diagram: %v", err)
+	}
+	index, _ := os.ReadFile(testPath + "/build/index.html")
+	for _, expected := range []string{
+		"</p><details class='diagram-source'><summary>View source</summary>",
+		`<span class="o">-&gt;</span>`,
+		"diagram-source-copy'>Copy</button>",
+		`button.textContent = "Copied";`,
+	} {
+		if !strings.Contains(string(index), expected) {
+			t.Errorf("expected the page to contain %s but found %s", expected, index)
+		}
+	}
+	if strings.Count(string(index), "<details class='diagram-source'>") != 1 || strings.Contains(string(index), "vault") {
+		t.Errorf("expected only the source of the diagram that wasn't hidden: %s", index)
+	}
+	// a source hidden on one page isn't published anywhere
+	for _, name := range []string{"secret", "private"} {
+		for _, file := range []string{name + ".d2", "diagrams/" + name + ".d2"} {
+			if _, err := os.Stat(testPath + "/build/" + file); err == nil {
+				t.Errorf("expected %s not to be published", file)
+			}
+		}
+		if site.Diagrams["/"+name+".svg"].Code != "" || site.Diagrams["/"+name+".svg"].DownloadPath != "" {
+			t.Errorf("expected %s not to have its source: %+v", name, site.Diagrams["/"+name+".svg"])
+		}
+	}
+	for _, page := range []string{"other.html", "hidden.html", "diagrams/secret.html"} {
+		contents, _ := os.ReadFile(testPath + "/build/" + page)
+		if strings.Contains(string(contents), "<details class='diagram-source'>") || strings.Contains(string(contents), `class="diagram-page-source"`) {
+			t.Errorf("expected %s not to show the source: %s", page, contents)
+		}
+	}
+}
+
+func TestWalkDirD2Links(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	for _, directory := range []string{"src/architecture", "src/payments"} {
+		err := os.MkdirAll(testPath+"/"+directory, os.ModePerm)
+		if err != nil {
+			t.Fatalf("tried to create test dir but could not: %v", err)
+		}
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"architecture/overview.d2": "payments: {\n  link: \"../payments/overview.md#ledger\"\n}\nservers.link: servers.d2\npayments -> servers\n",
+		"architecture/servers.d2":  "web -> db\n",
+		"architecture/index.md":    "# Architecture\n\n{{overview}}\n\n{{servers}}\n",
+		"payments/overview.md":     "# Payments\n\n## Ledger\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	traverseErrors = []error{}
+	defer func() {
+		traverseErrors = []error{}
+	}()
+	err := execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		StrictLinks:     true,
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v %v", err, traverseErrors)
+	}
+	svg, _ := os.ReadFile(testPath + "/build/architecture/overview.svg")
+	for _, expected := range []string{`<a href="/payments/overview.html#ledger"`, `<a href="/diagrams/architecture/servers.html"`} {
+		if !strings.Contains(string(svg), expected) {
+			t.Errorf("expected the diagram to link with %s: %s", expected, svg)
+		}
+	}
+
+	// with a base URL, the links in the pages and the diagrams are put under it
+	setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		StrictLinks:     true,
+		BaseURL:         "/docs/",
+	})
+	if err != nil {
+		t.Fatalf("tried to walk with a base URL but could not: %v %v", err, traverseErrors)
+	}
+	svg, _ = os.ReadFile(testPath + "/build/architecture/overview.svg")
+	for _, expected := range []string{`<a href="/docs/payments/overview.html#ledger"`, `<a href="/docs/diagrams/architecture/servers.html"`} {
+		if !strings.Contains(string(svg), expected) {
+			t.Errorf("expected the diagram to link with %s: %s", expected, svg)
+		}
+	}
+	page, _ := os.ReadFile(testPath + "/build/architecture/index.html")
+	for _, expected := range []string{`href="/docs/app.css"`, `href="/docs/payments/overview.html"`, `href="/docs/diagram_index.html"`, `src='/docs/architecture/overview.svg'`} {
+		if !strings.Contains(string(page), expected) {
+			t.Errorf("expected the page to link with %s: %s", expected, page)
+		}
+	}
+	if strings.Contains(string(page), "/docs/docs/") {
+		t.Errorf("expected the base URL to be added once: %s", page)
+	}
+	search, _ := os.ReadFile(testPath + "/build/search.html")
+	if !strings.Contains(string(search), `<a href="' + "/docs" + r.ref + '">`) {
+		t.Errorf("expected the search results to link under the base URL: %s", search)
+	}
+
+	// a link that points nowhere stops a strict build
+	err = os.WriteFile(testPath+"/src/architecture/servers.d2", []byte("web.link: ../billing/overview.md\n"), 0600)
+	if err != nil {
+		t.Fatalf("tried to write test file but could not: %v", err)
+	}
+	setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		StrictLinks:     true,
+	})
+	if err == nil || len(traverseErrors) != 1 || !strings.Contains(traverseErrors[0].Error(), "/architecture/servers.d2: link to /billing/overview.md") {
+		t.Errorf("expected the broken link in the diagram to be an error: %v %v", err, traverseErrors)
+	}
+}
+
+func TestWalkDirIncludes(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src/shared", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"page.md":            "---\ntitle: Page\n---\n\n{{include shared/_context.md}}\n\n{{include shared/config.yaml}}\n",
+		"shared/_context.md": "The shared system context.\n",
+		"shared/config.yaml": "replicas: 3\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	if len(site.Links) != 1 {
+		t.Fatalf("expected the partial to be left out of the pages but found %d pages", len(site.Links))
+	}
+	if strings.Join(site.Links[0].Includes, ",") != "/shared/_context.md,/shared/config.yaml" {
+		t.Errorf("expected the includes to be tracked but found %v", site.Links[0].Includes)
+	}
+	contents, _ := os.ReadFile(testPath + "/build/page.html")
+	if !strings.Contains(string(contents), "The shared system context.") || !strings.Contains(string(contents), "replicas") {
+		t.Errorf("expected the included content on the page")
+	}
+	if _, err := os.Stat(testPath + "/build/shared/_context.html"); err == nil {
+		t.Errorf("expected the partial to not be built as a page")
+	}
+}
+
+func TestWalkDirShortcodes(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	err = os.MkdirAll(testPath+"/shortcodes", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test shortcodes dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"src/page.md":          "---\ntitle: Page\n---\n\n{{< card \"Billing\" owner=payments />}}\n",
+		"shortcodes/card.html": `<div class="service-card">{{.Arg 0}} by {{.Get "owner"}}</div>`,
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:      testPath + "/src",
+		OutputDirectory:     testPath + "/build",
+		ShortcodesDirectory: testPath + "/shortcodes",
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	contents, _ := os.ReadFile(testPath + "/build/page.html")
+	if !strings.Contains(string(contents), `<div class="service-card">Billing by payments</div>`) {
+		t.Errorf("expected the shortcode to be rendered on the page")
+	}
+}
+
+func TestWalkDirDecisions(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"storage.md": "---\ntitle: Storage\n---\n\n> [!DECISION] Use Postgres\n> We need transactions.\n",
+		"api.md":     "---\ntitle: API\n---\n\n:::decision Version the API\nEvery route starts with /v1.\n:::\n\n:::warning\nNot a decision\n:::\n",
+		"draft.md":   "---\ntitle: Draft\ndraft: true\n---\n\n:::decision Not Yet\nStill deciding.\n:::\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	if len(site.Decisions) != 2 {
+		t.Fatalf("expected the two published decisions but found %v", site.Decisions)
+	}
+	contents, _ := os.ReadFile(testPath + "/build/decisions.html")
+	for _, expected := range []string{
+		`<a href="/storage.html#decision-use-postgres" class="decision-index-link">Use Postgres</a>`,
+		`<a href="/api.html#decision-version-the-api" class="decision-index-link">Version the API</a>`,
+		"Every route starts with /v1.",
+	} {
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("expected the decisions page to contain %s", expected)
+		}
+	}
+	if strings.Contains(string(contents), "Not Yet") {
+		t.Errorf("expected the draft decision to be left out")
+	}
+}
+
+func TestWalkDirConverters(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	err := os.MkdirAll(testPath+"/src", os.ModePerm)
+	if err != nil {
+		t.Fatalf("tried to create test src dir but could not: %v", err)
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"legacy.dot": `<svg xmlns="http://www.w3.org/2000/svg"><text>legacy</text></svg>`,
+		"index.md":   "---\ntitle: Legacy\n---\n\n{{legacy}}\n",
+	}
+	for name, content := range files {
+		err = os.WriteFile(testPath+"/src/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		Converters: map[string]ConverterConfig{
+			"dot": {Command: "cat"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	contents, err := os.ReadFile(testPath + "/build/legacy.svg")
+	if err != nil || !strings.Contains(string(contents), "legacy") {
+		t.Errorf("expected the converted diagram to be written: %v", err)
+	}
+	if _, err := os.Stat(testPath + "/build/legacy.dot"); err == nil {
+		t.Errorf("expected the source to not be copied")
+	}
+	if len(site.AllDiagrams["/legacy.svg"]) != 1 {
+		t.Errorf("expected the converted diagram to be in the index: %+v", site.AllDiagrams)
+	}
+
+	// a converter that fails is reported like a D2 error
+	setupSite()
+	traverseErrors = []error{}
+	defer func() {
+		traverseErrors = []error{}
+	}()
+	err = execute(&CommandOptions{
+		InputDirectory:  testPath + "/src",
+		OutputDirectory: testPath + "/build",
+		Converters: map[string]ConverterConfig{
+			".dot": {Command: "false"},
+		},
+	})
+	if err == nil || len(traverseErrors) != 1 || !strings.Contains(traverseErrors[0].Error(), "legacy.dot") {
+		t.Errorf("expected the failed conversion to stop the build: %v %v", err, traverseErrors)
+	}
+}
+
+func TestWalkDirData(t *testing.T) {
+	r := rand.Int63()
+	testPath := fmt.Sprintf("./test_data/test_%d", r)
+	for _, directory := range []string{"src", "shortcodes", "data/services"} {
+		err := os.MkdirAll(testPath+"/"+directory, os.ModePerm)
+		if err != nil {
+			t.Fatalf("tried to create test dir but could not: %v", err)
+		}
+	}
+	defer os.RemoveAll(testPath)
+
+	files := map[string]string{
+		"src/billing.md":            "+++\ntitle = \"Billing\"\ntags = [\"payments\"]\n+++\n\nOwned by {{< owner billing />}}\n",
+		"src/ledger.md":             "{\n  \"title\": \"Ledger\"\n}\n\nOwned by {{< owner ledger />}}\n",
+		"shortcodes/owner.html":     `{{with index .Data.services.owners (.Arg 0)}}<span class="owner">{{.team}}</span>{{end}}`,
+		"data/services/owners.yaml": "billing:\n  team: payments\nledger:\n  team: finance\n",
+		"data/environments.json":    `["dev", "prod"]`,
+		"page_template.html":        `<title>{{.Title}}</title>{{.Content}}<ul>{{range .Data.environments}}<li>{{.}}</li>{{end}}</ul>`,
+	}
+	for name, content := range files {
+		err := os.WriteFile(testPath+"/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("tried to write test file but could not: %v", err)
+		}
+	}
+
+	setupSite()
+	defer setupSite()
+	err := execute(&CommandOptions{
+		InputDirectory:      testPath + "/src",
+		OutputDirectory:     testPath + "/build",
+		PageTemplateFile:    testPath + "/page_template.html",
+		ShortcodesDirectory: testPath + "/shortcodes",
+		DataDirectory:       testPath + "/data",
+	})
+	if err != nil {
+		t.Fatalf("tried to walk but could not: %v", err)
+	}
+	for page, expected := range map[string]string{
+		"billing.html": `<title>Billing</title><h1>Billing</h1>
+<p>Owned by <span class="owner">payments</span></p>
+<ul><li>dev</li><li>prod</li></ul>`,
+		"ledger.html": `<span class="owner">finance</span>`,
+	} {
+		contents, _ := os.ReadFile(testPath + "/build/" + page)
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("expected %s to contain %s but found %s", page, expected, contents)
+		}
+	}
+	if len(site.SiteTags["payments"]) != 1 {
+		t.Errorf("expected the tags from the TOML front matter to be used: %v", site.SiteTags)
+	}
+}
@@ -3,6 +3,8 @@ module github.com/kevineaton/d2tosite
 go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/alecthomas/chroma v0.10.0
 	github.com/urfave/cli v1.22.10
 	github.com/yuin/goldmark v1.5.3
 	github.com/yuin/goldmark-meta v1.1.0
@@ -13,7 +15,6 @@ require (
 require (
 	cdr.dev/slog v1.4.2-0.20220126003130-b94a5ff54f37 // indirect
 	github.com/PuerkitoBio/goquery v1.8.0 // indirect
-	github.com/alecthomas/chroma v0.10.0 // indirect
 	github.com/andybalholm/cascadia v1.3.1 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/dlclark/regexp2 v1.7.0 // indirect
@@ -0,0 +1,257 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// DefaultAdmonitionTypes are the admonitions available when the options don't set them; the first
+// five match the alerts GitHub supports
+var DefaultAdmonitionTypes = []string{"note", "tip", "important", "warning", "caution", "decision", "deprecated"}
+
+// DecisionAdmonitionType is the admonition type that is collected into the site's list of decisions
+const DecisionAdmonitionType = "decision"
+
+// KindAdmonition is the goldmark node kind for an admonition
+var KindAdmonition = ast.NewNodeKind("Admonition")
+
+// alertRegex finds the GitHub-style marker on the first line of a blockquote, such as [!WARNING]
+var alertRegex = regexp.MustCompile(`^\[!(\w+)\][ \t]*(.*?)\s*$`)
+
+// containerRegex finds the opening line of a container, such as :::note or ::::warning Custom Title
+var containerRegex = regexp.MustCompile(`^(:{3,})[ \t]*([\w-]+)[ \t]*(.*?)\s*$`)
+
+// decisionsContextKey is used to pass the decisions found by the transformer back to ParseMD
+var decisionsContextKey = parser.NewContextKey()
+
+// Decision is an admonition of the decision type, collected so the site can list every decision
+type Decision struct {
+	ID      string // the ID of the admonition on the page, to link to it
+	Title   string
+	Summary string // the text of the first paragraph
+}
+
+// Admonition is a callout block, such as a warning or a note, holding the blocks inside of it
+type Admonition struct {
+	ast.BaseBlock
+	AdmonitionType string
+	Title          string
+	colons         int // the length of the fence for the ::: syntax, so nested containers can be closed
+}
+
+// Kind implements the goldmark Node
+func (n *Admonition) Kind() ast.NodeKind {
+	return KindAdmonition
+}
+
+// Dump implements the goldmark Node
+func (n *Admonition) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"AdmonitionType": n.AdmonitionType,
+		"Title":          n.Title,
+	}, nil)
+}
+
+// admonitionTypes is the set of types that are enabled
+type admonitionTypes map[string]bool
+
+func newAdmonitionTypes(types []string) admonitionTypes {
+	if len(types) == 0 {
+		types = DefaultAdmonitionTypes
+	}
+	enabled := admonitionTypes{}
+	for _, admonitionType := range types {
+		enabled[strings.ToLower(strings.TrimSpace(admonitionType))] = true
+	}
+	return enabled
+}
+
+// newAdmonition creates the node, using the type as the title if there isn't one
+func (types admonitionTypes) newAdmonition(admonitionType string, title string) *Admonition {
+	admonitionType = strings.ToLower(admonitionType)
+	if title == "" {
+		title = strings.ToUpper(admonitionType[:1]) + admonitionType[1:]
+	}
+	return &Admonition{
+		AdmonitionType: admonitionType,
+		Title:          title,
+	}
+}
+
+// admonitionParser parses the :::type container syntax, which is closed by a line with the same number of colons
+type admonitionParser struct {
+	types admonitionTypes
+}
+
+// Trigger implements the goldmark BlockParser
+func (p *admonitionParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+// Open implements the goldmark BlockParser
+func (p *admonitionParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	found := containerRegex.FindSubmatch(line)
+	if len(found) == 0 || !p.types[strings.ToLower(string(found[2]))] {
+		return nil, parser.NoChildren
+	}
+	admonition := p.types.newAdmonition(string(found[2]), string(found[3]))
+	admonition.colons = len(found[1])
+	reader.Advance(lineLength(line, segment))
+	return admonition, parser.HasChildren
+}
+
+// Continue implements the goldmark BlockParser
+func (p *admonitionParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == node.(*Admonition).colons && len(bytes.Trim(trimmed, ":")) == 0 {
+		reader.Advance(lineLength(line, segment))
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+// lineLength is how far to advance to consume the line up to the newline
+func lineLength(line []byte, segment text.Segment) int {
+	return segment.Len() - util.TrimRightSpaceLength(line) - segment.Padding
+}
+
+// Close implements the goldmark BlockParser
+func (p *admonitionParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph implements the goldmark BlockParser
+func (p *admonitionParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements the goldmark BlockParser
+func (p *admonitionParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// admonitionTransformer turns blockquotes starting with a GitHub-style [!TYPE] marker into admonitions,
+// and then collects the decisions
+type admonitionTransformer struct {
+	types admonitionTypes
+}
+
+// Transform implements the goldmark ASTTransformer
+func (transformer *admonitionTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	quotes := []*ast.Blockquote{}
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if quote, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, quote := range quotes {
+		transformer.convertAlert(quote, source)
+	}
+
+	decisions := []Decision{}
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		admonition, ok := n.(*Admonition)
+		if !entering || !ok || admonition.AdmonitionType != DecisionAdmonitionType {
+			return ast.WalkContinue, nil
+		}
+		id := string(pc.IDs().Generate([]byte("decision "+admonition.Title), KindAdmonition))
+		admonition.SetAttributeString("id", []byte(id))
+		summary := ""
+		if paragraph, isParagraph := admonition.FirstChild().(*ast.Paragraph); isParagraph {
+			summary = strings.TrimSpace(string(paragraph.Text(source)))
+		}
+		decisions = append(decisions, Decision{
+			ID:      id,
+			Title:   admonition.Title,
+			Summary: summary,
+		})
+		return ast.WalkContinue, nil
+	})
+	pc.Set(decisionsContextKey, decisions)
+}
+
+// convertAlert replaces the blockquote with an admonition if its first line is a known marker
+func (transformer *admonitionTransformer) convertAlert(quote *ast.Blockquote, source []byte) {
+	paragraph, ok := quote.FirstChild().(*ast.Paragraph)
+	if !ok || paragraph.Lines().Len() == 0 {
+		return
+	}
+	first := paragraph.Lines().At(0)
+	found := alertRegex.FindSubmatch(first.Value(source))
+	if len(found) == 0 || !transformer.types[strings.ToLower(string(found[1]))] {
+		return
+	}
+	admonition := transformer.types.newAdmonition(string(found[1]), string(found[2]))
+
+	// the marker's line is dropped from the paragraph, leaving the rest of the text
+	for child := paragraph.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		start := inlineStart(child)
+		if start == -1 || start >= first.Stop {
+			break
+		}
+		paragraph.RemoveChild(paragraph, child)
+		child = next
+	}
+	lines := text.NewSegments()
+	for i := 1; i < paragraph.Lines().Len(); i++ {
+		lines.Append(paragraph.Lines().At(i))
+	}
+	paragraph.SetLines(lines)
+	if !paragraph.HasChildren() {
+		quote.RemoveChild(quote, paragraph)
+	}
+
+	for child := quote.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		admonition.AppendChild(admonition, child)
+		child = next
+	}
+	quote.Parent().ReplaceChild(quote.Parent(), quote, admonition)
+}
+
+// inlineStart finds where an inline node starts in the source, or -1 if it can't be found
+func inlineStart(node ast.Node) int {
+	if textNode, ok := node.(*ast.Text); ok {
+		return textNode.Segment.Start
+	}
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		if start := inlineStart(child); start != -1 {
+			return start
+		}
+	}
+	return -1
+}
+
+// admonitionRenderer renders the admonitions as an aside with a title
+type admonitionRenderer struct{}
+
+// RegisterFuncs implements the goldmark NodeRenderer
+func (r *admonitionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindAdmonition, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		n := node.(*Admonition)
+		if !entering {
+			_, _ = w.WriteString("</aside>\n")
+			return ast.WalkContinue, nil
+		}
+		id := ""
+		if value, found := n.AttributeString("id"); found {
+			if converted, ok := value.([]byte); ok {
+				id = fmt.Sprintf(` id="%s"`, util.EscapeHTML(converted))
+			}
+		}
+		_, _ = w.WriteString(fmt.Sprintf(`<aside class="admonition admonition-%s"%s role="note">`+"\n", util.EscapeHTML([]byte(n.AdmonitionType)), id))
+		_, _ = w.WriteString(fmt.Sprintf(`<p class="admonition-title">%s</p>`+"\n", util.EscapeHTML([]byte(n.Title))))
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,103 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestAdmonitions(t *testing.T) {
+	tests := []struct {
+		Input            string
+		Types            []string
+		ExpectedContains []string
+		ExpectedMissing  []string
+	}{
+		{
+			Input: "# Page\n\n> [!WARNING]\n> Do **not** do this\n",
+			ExpectedContains: []string{
+				"<aside class=\"admonition admonition-warning\" role=\"note\">\n<p class=\"admonition-title\">Warning</p>\n<p>Do <strong>not</strong> do this</p>\n</aside>",
+			},
+			ExpectedMissing: []string{"<blockquote>", "[!WARNING]"},
+		},
+		{
+			Input:            "# Page\n\n> [!note] Read This First\n>\n> - one\n> - two\n",
+			ExpectedContains: []string{`<aside class="admonition admonition-note" role="note">`, `<p class="admonition-title">Read This First</p>`, "<li>one</li>"},
+		},
+		{
+			Input:            "# Page\n\n> [!UNKNOWN]\n> Just a quote\n",
+			ExpectedContains: []string{"<blockquote>", "[!UNKNOWN]"},
+			ExpectedMissing:  []string{"admonition"},
+		},
+		{
+			Input:            "# Page\n\n> A normal quote\n",
+			ExpectedContains: []string{"<blockquote>\n<p>A normal quote</p>\n</blockquote>"},
+		},
+		{
+			Input: "# Page\n\n:::deprecated Old API\nUse the *new* one\n:::\n\nAfter\n",
+			ExpectedContains: []string{
+				"<aside class=\"admonition admonition-deprecated\" role=\"note\">\n<p class=\"admonition-title\">Old API</p>\n<p>Use the <em>new</em> one</p>\n</aside>\n<p>After</p>",
+			},
+		},
+		{
+			Input:            "# Page\n\n::::warning\nOuter\n\n:::tip\nInner\n:::\n\nStill outer\n::::\n",
+			ExpectedContains: []string{"<p class=\"admonition-title\">Tip</p>\n<p>Inner</p>\n</aside>\n<p>Still outer</p>\n</aside>"},
+		},
+		{
+			Input:            "# Page\n\n:::tip\nNo closing fence",
+			ExpectedContains: []string{"<p class=\"admonition-title\">Tip</p>\n<p>No closing fence</p>\n</aside>"},
+		},
+		{
+			Input:            "# Page\n\n:::risk\nNot a known type\n:::\n\n> [!WARNING]\n> Turned off\n",
+			Types:            []string{"risk"},
+			ExpectedContains: []string{`<aside class="admonition admonition-risk" role="note">`, "<blockquote>"},
+		},
+	}
+
+	for i := range tests {
+		leaf, err := parse.ParseMD([]byte(tests[i].Input), "/", &parse.MarkdownOptions{AdmonitionTypes: tests[i].Types})
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		content := string(leaf.Content)
+		for _, expected := range tests[i].ExpectedContains {
+			if !strings.Contains(content, expected) {
+				t.Errorf("test %d: expected the content to contain %s but found %s", i, expected, content)
+			}
+		}
+		for _, missing := range tests[i].ExpectedMissing {
+			if strings.Contains(content, missing) {
+				t.Errorf("test %d: expected the content to not contain %s but found %s", i, missing, content)
+			}
+		}
+	}
+}
+
+func TestDecisions(t *testing.T) {
+	input := "# Page\n\n## Storage\n\n> [!DECISION] Use Postgres\n> We need transactions.\n\n:::decision\nKeep the API versioned.\n:::\n\n:::decision Use Postgres\nAgain\n:::\n\n> [!NOTE]\n> Not a decision\n"
+	leaf, err := parse.ParseMD([]byte(input), "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []parse.Decision{
+		{ID: "decision-use-postgres", Title: "Use Postgres", Summary: "We need transactions."},
+		{ID: "decision-decision", Title: "Decision", Summary: "Keep the API versioned."},
+		{ID: "decision-use-postgres-1", Title: "Use Postgres", Summary: "Again"},
+	}
+	if len(leaf.Decisions) != len(expected) {
+		t.Fatalf("expected %d decisions but found %v", len(expected), leaf.Decisions)
+	}
+	for i := range expected {
+		if leaf.Decisions[i] != expected[i] {
+			t.Errorf("decision %d: expected %v but found %v", i, expected[i], leaf.Decisions[i])
+		}
+	}
+	if !strings.Contains(string(leaf.Content), `<aside class="admonition admonition-decision" id="decision-use-postgres" role="note">`) {
+		t.Errorf("expected the decision to have its ID: %s", leaf.Content)
+	}
+	if len(leaf.TOC) != 1 || leaf.TOC[0].ID != "storage" {
+		t.Errorf("expected the decisions to not change the headings: %v", leaf.TOC)
+	}
+}
@@ -3,31 +3,94 @@ package parser
 import (
 	"bytes"
 	"context"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"html/template"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/yuin/goldmark"
 	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	"oss.terrastruct.com/d2/d2exporter"
+	"oss.terrastruct.com/d2/d2graph"
 	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
 	"oss.terrastruct.com/d2/d2layouts/d2elklayout"
 	"oss.terrastruct.com/d2/d2lib"
 	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
 	"oss.terrastruct.com/d2/lib/textmeasure"
 )
 
 // these regexes are used to check for data within the markdown
-var imageReplaceRegex = regexp.MustCompile(`{{(\w+)}}`)
-var titleRegex = regexp.MustCompile(`<h1>(\w+)</h1>`)
+var imageReplaceRegex = regexp.MustCompile(`{{(\w+|(?:/[\w.-]+)*/\w+)((?:\s+(?:inline|img|nosource))*)}}`)
+var includeStartRegex = regexp.MustCompile(`(?m)^\s*{{include\s`)
 
 // ParseOptions are options relevants specifically to parsing, usually
 // filled in automatically from the CommandOptions if run from the binary
 type ParseOptions struct {
-	D2Theme  int64
-	D2Layout string // one of elk or dagre, defaults ot dagre; tala is not supported in the library
+	D2Theme        int64
+	D2Layout       string       // one of elk or dagre, defaults ot dagre; tala is not supported in the library
+	D2Pad          int          // the padding around the diagram in pixels; 0 uses D2's default of 100 and a negative value removes it
+	D2DisableFonts bool         // leave the fonts out of the SVG, so it is much smaller but uses the reader's sans-serif font
+	Links          LinkResolver // rewrites the link of each shape before it is rendered, if set
+}
+
+// LinkResolver rewrites the links on the shapes of a diagram, such as pointing a link to a source
+// file at the page built from it
+type LinkResolver interface {
+	ResolveLink(link string) string // given the link as written in the D2
+}
+
+// MarkdownOptions are options relevant to parsing Markdown, usually filled in
+// automatically from the CommandOptions if run from the binary
+type MarkdownOptions struct {
+	TOCMinLevel int // the smallest heading level to include in the table of contents, defaults to 2
+	TOCMaxLevel int // the largest heading level to include in the table of contents, defaults to 4
+
+	CodeStyle       string // the chroma style for highlighting fenced code, defaults to github
+	CodeLineNumbers bool   // whether to show line numbers on fenced code
+	CodeClasses     bool   // whether to use CSS classes instead of inline styles; see CodeStyleCSS for the stylesheet
+
+	// the GitHub-flavored extensions and typographer are on by default and can be turned off individually
+	DisableTables         bool
+	DisableStrikethrough  bool
+	DisableTaskList       bool
+	DisableLinkify        bool
+	DisableFootnotes      bool
+	DisableDefinitionList bool
+	DisableTypographer    bool
+	DisableMath           bool // $x$ and $$x$$ rendered to SVG with MathJax
+
+	// the directory that {{include path}} is resolved within; includes are left as is when it isn't set,
+	// and they can never point outside of it
+	IncludeRoot string
+
+	// the templates for the {{< name >}} shortcodes, usually from LoadShortcodes; shortcodes are left
+	// as is when this is nil, and are an error if the name isn't found otherwise
+	Shortcodes map[string]*template.Template
+
+	// the site's data files, usually from LoadData, which are passed to the shortcodes
+	Data map[string]interface{}
+
+	// the admonitions that can be used with > [!TYPE] or :::type, defaults to DefaultAdmonitionTypes
+	AdmonitionTypes []string
+
+	HardWraps bool // render newlines in paragraphs as <br>
+	Unsafe    bool // render raw HTML and potentially dangerous links instead of omitting them
+	XHTML     bool // render XHTML instead of HTML5
+
+	// these are added after the built in options, so library users can add their own goldmark
+	// extensions or override the defaults
+	Extensions      []goldmark.Extender
+	ParserOptions   []parser.Option
+	RendererOptions []renderer.Option
 }
 
 // LeafData holds the data for a leaf that will then be used to build the site
@@ -40,130 +103,491 @@ type LeafData struct {
 	Diagrams []string              // needed for the index
 	Content  template.HTML         // used for converting to an html template
 	Summary  string                // used for search displays, found in the meta
+
+	FrontMatter   FrontMatter // everything provided in the meta, including the free-form Params
+	TOC           []*TOCEntry // the nested table of contents, empty if turned off for the page
+	Anchors       []string    // the IDs of every heading on the page
+	References    []string    // the site paths of the pages linked to, such as /dir/page.html#heading
+	Includes      []string    // the files included into the page, such as /shared/context.md, which it needs to be rebuilt for
+	Decisions     []Decision  // the decision admonitions on the page
+	HiddenSources []string    // the Diagrams whose source is hidden with d2_source: false or {{name nosource}}
+
+	// these are filled in by the caller once every page is known
+	Backlinks   []PageReference            // the other pages that link to this page
+	EmbeddedBy  map[string][]PageReference // for each diagram on this page, the other pages that also embed it
+	Scheduled   bool                       // set by the caller when the publish date is in the future but the page is included
+	Data        map[string]interface{}     // the site's data files, so the templates can use them
+	DiagramData []DiagramData              // each of the Diagrams that compiled, in the same order
+
+	// these are filled in by the caller for the page's language
+	Language     string            // the language code of the page, such as en
+	LanguagePath string            // the path the language is published under, such as /de, or empty for the default language
+	BaseURL      string            // the URL the site is served from, such as https://example.com/docs, or empty for the root
+	Translations []Translation     // the page in the site's other languages, for a language switcher
+	Strings      map[string]string // the text for the templates in the page's language, such as the navigation headers
+}
+
+// Translation is a version of a page in another language
+type Translation struct {
+	Language string // the language code, such as de
+	Name     string // the name of the language, such as Deutsch
+	FileName string
+}
+
+// PageReference is a small pointer to a page, used when pages refer to each other
+type PageReference struct {
+	Title    string
+	FileName string
+	Summary  string
 }
 
 // ParseMD takes a series of bytes, such as from a file, and parses the MD into HTML, with meta data set
 // in the LeafData return
-func ParseMD(content []byte, prefix string) (*LeafData, error) {
+func ParseMD(content []byte, prefix string, options *MarkdownOptions) (*LeafData, error) {
 	data := &LeafData{}
 
 	if len(content) == 0 {
 		return data, errors.New("invalid markdown content")
 	}
+	// the defaults are filled in on a copy, since the same options are usually given for every page
+	pageOptions := MarkdownOptions{}
+	if options != nil {
+		pageOptions = *options
+	}
+	options = &pageOptions
+	if options.TOCMinLevel == 0 {
+		options.TOCMinLevel = 2
+	}
+	if options.TOCMaxLevel == 0 {
+		options.TOCMaxLevel = 4
+	}
 
-	markdown := goldmark.New(goldmark.WithExtensions(meta.Meta))
-	var buf bytes.Buffer
-	pctx := parser.NewContext()
-	err := markdown.Convert(content, &buf, parser.WithContext(pctx))
+	// TOML and JSON front matter are split out here, while YAML is handled by goldmark-meta
+	rawMeta, content, hasFrontMatter, err := splitFrontMatter(content)
 	if err != nil {
 		return data, err
 	}
-	meta := meta.Get(pctx)
-	output := buf.Bytes()
 
-	tags := []string{}
-	if t, tOK := meta["tags"]; tOK {
-		if converted, cOK := t.([]interface{}); cOK {
-			for i := range converted {
-				tags = append(tags, fmt.Sprintf("%v", converted[i]))
-			}
+	data.Includes = []string{}
+	if options.IncludeRoot != "" && includeStartRegex.Match(content) {
+		expanded, includes, err := expandIncludes(content, prefix, options.IncludeRoot)
+		if err != nil {
+			return data, err
 		}
+		content = expanded
+		data.Includes = includes
 	}
 
-	title := ""
-	if t, tOK := meta["title"]; tOK {
-		if converted, cOK := t.(string); cOK {
-			title = converted
+	markdown := newMarkdown(options, prefix)
+	ids := newHeadingIDs()
+	var shortcodes *shortcodeRenderer
+	if options.Shortcodes != nil && (shortcodeRegex.Match(content) || shortcodeEscapeRegex.Match(content)) {
+		shortcodes = newShortcodeRenderer(markdown, ids, options.Shortcodes, prefix, options.Data)
+		processed, err := shortcodes.process(string(content))
+		if err != nil {
+			return data, err
 		}
+		content = []byte(processed)
 	}
 
-	summary := ""
-	if t, tOK := meta["summary"]; tOK {
-		if converted, cOK := t.(string); cOK {
-			summary = converted
+	var buf bytes.Buffer
+	pctx := parser.NewContext(parser.WithIDs(ids))
+	err = markdown.Convert(content, &buf, parser.WithContext(pctx))
+	if err != nil {
+		return data, err
+	}
+	if !hasFrontMatter {
+		rawMeta, err = meta.TryGet(pctx)
+		if err != nil {
+			return data, fmt.Errorf("front matter: %v", err)
 		}
 	}
+	frontMatter, err := ParseFrontMatter(rawMeta)
+	if err != nil {
+		return data, err
+	}
+	output := buf.Bytes()
+	headings, _ := pctx.Get(headingsContextKey).([]*TOCEntry)
+	references, _ := pctx.Get(referencesContextKey).([]string)
+	decisions, _ := pctx.Get(decisionsContextKey).([]Decision)
+	if shortcodes != nil {
+		output = []byte(shortcodes.replace(string(output)))
+		references = append(references, shortcodes.references...)
+		headings, decisions = shortcodes.collect(string(output), headings, decisions)
+	}
 
+	title := frontMatter.Title
+	summary := frontMatter.Summary
 	if summary == "" {
 		summary = fmt.Sprintf("%s's content and information", title)
 	}
 
 	// replace images
-	matches := imageReplaceRegex.FindAll(output, -1)
-	for i := range matches {
-		diagram := strings.ReplaceAll(string(matches[i]), "{{", prefix)
-		diagram = strings.ReplaceAll(diagram, "}}", ".svg")
+	// an embed may also ask to be inlined or kept as an image with {{name inline}} or {{name img}}, and
+	// to hide its source with {{name nosource}}, which are left as data attributes for the caller to act on
+	output = imageReplaceRegex.ReplaceAllFunc(output, func(match []byte) []byte {
+		parts := imageReplaceRegex.FindSubmatch(match)
+		diagram := prefix + string(parts[1]) + ".svg"
+		if bytes.HasPrefix(parts[1], []byte("/")) {
+			// a diagram in another directory is embedded from the root, such as {{/flows/login}}
+			diagram = string(parts[1]) + ".svg"
+		}
 		data.Diagrams = append(data.Diagrams, diagram)
-	}
-	output = imageReplaceRegex.ReplaceAll(output, []byte(fmt.Sprintf("<img src='%s$1.svg' class='diagram-svg' alt='diagram' />", prefix)))
+		mode := ""
+		hidden := !frontMatter.D2Source
+		for _, word := range strings.Fields(string(parts[2])) {
+			if word == "nosource" {
+				hidden = true
+			} else {
+				mode = word
+			}
+		}
+		embed := ""
+		if mode != "" {
+			embed = fmt.Sprintf(" data-embed='%s'", mode)
+		}
+		if hidden {
+			embed += " data-source='hidden'"
+			data.HiddenSources = append(data.HiddenSources, diagram)
+		}
+		return []byte(fmt.Sprintf("<img src='%s' class='diagram-svg' alt='diagram'%s />", diagram, embed))
+	})
 
 	// we want to make sure our pages are generally correct, so we need to split here
 	// first, if there's no title, we need to see if it's in the markdown by default
 	// then, if the title WAS provided, we want to add it to the top of the content IF
 	// there isn't one already
+	var firstH1 *TOCEntry
+	for _, heading := range headings {
+		if heading.Level == 1 {
+			firstH1 = heading
+			break
+		}
+	}
 	if title == "" {
-		titleBytes := titleRegex.Find(output)
-		if len(titleBytes) > 0 {
-			title = strings.Replace(string(titleBytes), "<h1>", "", -1)
-			title = strings.Replace(title, "</h1>", "", -1)
+		if firstH1 != nil {
+			title = firstH1.Title
 		}
 		// if it's still blank, it's unknown, and the caller can handle that
 	} else {
-		// title is known, we need to see if we need to add it; since this is pretty
-		// straight forward, we only need to see if the <h1> tag exists. If it does,
+		// title is known, we need to see if we need to add it; if there is an <h1> already,
 		// we can assume that the title is in the content so don't worry about adding it
-		if !strings.Contains(string(output), "<h1>") {
-			output = append([]byte(fmt.Sprintf("<h1>%s</h1>\n", title)), output...)
+		if firstH1 == nil {
+			output = append([]byte(fmt.Sprintf("<h1>%s</h1>\n", template.HTMLEscapeString(title))), output...)
 		}
 	}
 
+	data.References = references
+	data.Decisions = decisions
+	if data.Decisions == nil {
+		data.Decisions = []Decision{}
+	}
+	data.Anchors = []string{}
+	for _, heading := range headings {
+		data.Anchors = append(data.Anchors, heading.ID)
+	}
+	data.TOC = []*TOCEntry{}
+	if frontMatter.TOC {
+		data.TOC = BuildTOC(headings, options.TOCMinLevel, options.TOCMaxLevel)
+	}
+
+	frontMatter.Title = title
+	data.FrontMatter = frontMatter
 	data.Content = template.HTML(output)
 	data.Title = title
-	data.Tags = tags
+	data.Tags = frontMatter.Tags
 	data.Summary = summary
 	return data, nil
 }
 
+// newMarkdown builds the goldmark pipeline from the options
+func newMarkdown(options *MarkdownOptions, prefix string) goldmark.Markdown {
+	extensions := []goldmark.Extender{meta.Meta}
+	toggles := []struct {
+		disabled  bool
+		extension goldmark.Extender
+	}{
+		{options.DisableTables, extension.Table},
+		{options.DisableStrikethrough, extension.Strikethrough},
+		{options.DisableTaskList, extension.TaskList},
+		{options.DisableLinkify, extension.Linkify},
+		{options.DisableFootnotes, extension.Footnote},
+		{options.DisableDefinitionList, extension.DefinitionList},
+		{options.DisableTypographer, extension.Typographer},
+	}
+	for _, toggle := range toggles {
+		if !toggle.disabled {
+			extensions = append(extensions, toggle.extension)
+		}
+	}
+	extensions = append(extensions, options.Extensions...)
+
+	admonitions := newAdmonitionTypes(options.AdmonitionTypes)
+	parserOptions := []parser.Option{
+		parser.WithAutoHeadingID(),
+		parser.WithBlockParsers(util.Prioritized(&admonitionParser{types: admonitions}, 750)),
+		parser.WithInlineParsers(util.Prioritized(&wikiLinkParser{}, 199)),
+		parser.WithASTTransformers(
+			util.Prioritized(&headingTransformer{}, 100),
+			util.Prioritized(&markdownLinkTransformer{prefix: prefix}, 100),
+			util.Prioritized(&admonitionTransformer{types: admonitions}, 100),
+		),
+	}
+	if !options.DisableMath {
+		parserOptions = append(parserOptions,
+			parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 760)),
+			parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 150)),
+		)
+	}
+	parserOptions = append(parserOptions, options.ParserOptions...)
+
+	rendererOptions := []renderer.Option{
+		renderer.WithNodeRenderers(
+			util.Prioritized(newCodeRenderer(options), 100),
+			util.Prioritized(&wikiLinkRenderer{}, 100),
+			util.Prioritized(&admonitionRenderer{}, 100),
+		),
+	}
+	if !options.DisableMath {
+		rendererOptions = append(rendererOptions, renderer.WithNodeRenderers(util.Prioritized(&mathRenderer{}, 100)))
+	}
+	if options.HardWraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+	if options.Unsafe {
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
+	if options.XHTML {
+		rendererOptions = append(rendererOptions, html.WithXHTML())
+	}
+	rendererOptions = append(rendererOptions, options.RendererOptions...)
+
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+}
+
 // ParseD2 takes in the bytes, such as from a file or a stream, and processes it through
 // the D2 library for output
 func ParseD2(input []byte, options *ParseOptions) ([]byte, error) {
-	bytes := []byte{}
-	if len(input) == 0 {
-		return bytes, errors.New("invalid input")
-	}
+	out, _, err := CompileD2(input, options)
+	return out, err
+}
+
+// CompileD2 processes the D2 like ParseD2, also describing the diagram that was compiled. The
+// Source and Path of the DiagramData are left for the caller, since only it knows where the
+// diagram came from and where it is published.
+func CompileD2(input []byte, options *ParseOptions) ([]byte, *DiagramData, error) {
 	if options == nil {
 		options = &ParseOptions{
 			D2Theme: 1,
 		}
 	}
+	rendered, data, err := CompileD2Themes(input, options, options.D2Theme)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return rendered[0], data, nil
+}
+
+// D2LayoutName checks that the layout engine is one the library supports, either dagre or elk, ignoring
+// case, so a typo isn't quietly laid out with dagre
+func D2LayoutName(value string) (string, error) {
+	layout := strings.ToLower(strings.TrimSpace(value))
+	if layout != "dagre" && layout != "elk" {
+		return "", fmt.Errorf("D2 layout '%s' is not known; it can be dagre or elk", value)
+	}
+	return layout, nil
+}
+
+// CompileD2Themes compiles and lays out the diagram once, then renders it with each of the themes
+// in order, so another theme, such as a dark one, only costs the rendering. The theme in the options
+// is ignored, and the DiagramData, including its Model, describes the first theme.
+func CompileD2Themes(input []byte, options *ParseOptions, themes ...int64) ([][]byte, *DiagramData, error) {
+	rendered := [][]byte{}
+	if len(input) == 0 {
+		return rendered, nil, errors.New("invalid input")
+	}
+	if len(themes) == 0 {
+		return rendered, nil, errors.New("at least one theme is needed")
+	}
+	if options == nil {
+		options = &ParseOptions{}
+	}
 	ruler, err := textmeasure.NewRuler()
 	if err != nil {
-		return bytes, err
+		return rendered, nil, err
 	}
 
 	compileOptions := &d2lib.CompileOptions{
 		Ruler:   ruler,
-		ThemeID: options.D2Theme,
+		ThemeID: themes[0],
 	}
+	layout := "dagre"
 	switch strings.ToLower(options.D2Layout) {
 	case "elk":
 		compileOptions.Layout = d2elklayout.Layout
+		layout = "elk"
 	case "dagre":
 		compileOptions.Layout = d2dagrelayout.Layout
 	default:
 		compileOptions.Layout = d2dagrelayout.Layout
 	}
 
-	diagram, _, err := d2lib.Compile(context.Background(), string(input), compileOptions)
+	start := time.Now()
+	diagram, graph, err := d2lib.Compile(context.Background(), string(input), compileOptions)
 	if err != nil {
-		return bytes, err
+		return rendered, nil, err
 	}
 
-	out, err := d2svg.Render(diagram, d2svg.DEFAULT_PADDING)
+	if options.Links != nil {
+		resolveShapeLinks(graph, diagram, options.Links)
+	}
 
-	if err != nil {
-		return bytes, err
+	pad := d2svg.DEFAULT_PADDING
+	if options.D2Pad > 0 {
+		pad = options.D2Pad
+	} else if options.D2Pad < 0 {
+		pad = 0
+	}
+	model := &DiagramModel{
+		Diagram: diagram,
+		Graph:   summarizeGraph(graph),
+	}
+	entities := locateEntities(diagram, pad)
+	for i, id := range themes {
+		theme, inCatalog := findD2Theme(id)
+		switch {
+		case !inCatalog:
+			// D2 can't find the theme itself, so it is exported here with the theme's colors
+			diagram, err = exportTheme(graph, theme)
+		case i > 0:
+			// the layout is already on the graph, so only the colors need to be exported again
+			diagram, err = d2exporter.Export(context.Background(), graph, id)
+		}
+		if err != nil {
+			return rendered, nil, err
+		}
+		out, err := d2svg.Render(diagram, pad)
+		if err != nil {
+			return rendered, nil, err
+		}
+		if options.D2DisableFonts {
+			out = removeEmbeddedFonts(out)
+		}
+		if isDarkTheme(id) {
+			out = applyDarkTheme(out, theme)
+		}
+		rendered = append(rendered, addLinksAndTooltips(out, diagram))
 	}
 
-	return out, nil
+	data := describeGraph(graph)
+	data.Theme = themes[0]
+	data.ThemeName = D2ThemeName(themes[0])
+	data.Layout = layout
+	data.CompileDuration = time.Since(start)
+	data.Size, _ = SVGSize(rendered[0])
+	data.Model = model
+	data.Entities = entities
+	return rendered, data, nil
+}
+
+// addLinksAndTooltips wraps any shapes with a link in an anchor and adds a title for any
+// tooltips, since the D2 renderer doesn't output them itself
+func addLinksAndTooltips(svg []byte, diagram *d2target.Diagram) []byte {
+	output := string(svg)
+	for _, shape := range diagram.Shapes {
+		if shape.Link == "" && shape.Tooltip == "" {
+			continue
+		}
+		open := fmt.Sprintf(`<g id="%s">`, escapeXML(shape.ID))
+		start := strings.Index(output, open)
+		if start == -1 {
+			continue
+		}
+		end := findGroupEnd(output, start+len(open))
+		if end == -1 {
+			continue
+		}
+		group := output[start:end]
+		if shape.Tooltip != "" {
+			group = open + fmt.Sprintf("<title>%s</title>", escapeXML(shape.Tooltip)) + group[len(open):]
+		}
+		if shape.Link != "" {
+			group = fmt.Sprintf(`<a href="%s" target="_top">%s</a>`, escapeXML(shape.Link), group)
+		}
+		output = output[:start] + group + output[end:]
+	}
+	return []byte(output)
+}
+
+// resolveShapeLinks rewrites the links on both the graph, which the later themes are exported from,
+// and the diagram that was already exported from it
+func resolveShapeLinks(graph *d2graph.Graph, diagram *d2target.Diagram, links LinkResolver) {
+	resolved := map[string]string{}
+	for _, object := range graph.Objects {
+		if object.Attributes.Link == "" {
+			continue
+		}
+		object.Attributes.Link = links.ResolveLink(object.Attributes.Link)
+		resolved[object.AbsID()] = object.Attributes.Link
+	}
+	for i := range diagram.Shapes {
+		if link, found := resolved[diagram.Shapes[i].ID]; found {
+			diagram.Shapes[i].Link = link
+		}
+	}
+}
+
+// findGroupEnd finds the index just past the </g> that closes a group, starting after the opening tag
+func findGroupEnd(svg string, from int) int {
+	depth := 1
+	for i := from; i < len(svg); i++ {
+		if strings.HasPrefix(svg[i:], "</g>") {
+			depth--
+			if depth == 0 {
+				return i + len("</g>")
+			}
+		} else if strings.HasPrefix(svg[i:], "<g>") || strings.HasPrefix(svg[i:], "<g ") {
+			depth++
+		}
+	}
+	return -1
+}
+
+// embeddedFontsStyle starts the stylesheet the D2 renderer adds at the end of the SVG with the
+// fonts encoded in it
+const embeddedFontsStyle = `<style type="text/css"><![CDATA[`
+
+// systemFontsStyle points the D2 text classes at the reader's fonts instead
+const systemFontsStyle = `<style type="text/css"><![CDATA[
+.text, .text-bold, .text-italic { font-family: "Source Sans Pro", sans-serif; }
+.text-bold { font-weight: bold; }
+.text-italic { font-style: italic; }
+.text-mono { font-family: "Source Code Pro", monospace; }
+]]></style>`
+
+// removeEmbeddedFonts swaps the fonts the D2 renderer embeds for the reader's own fonts
+func removeEmbeddedFonts(svg []byte) []byte {
+	start := bytes.LastIndex(svg, []byte(embeddedFontsStyle))
+	if start == -1 {
+		return svg
+	}
+	end := bytes.Index(svg[start:], []byte("]]></style>"))
+	if end == -1 {
+		return svg
+	}
+	end += start + len("]]></style>")
+	removed := append([]byte{}, svg[:start]...)
+	removed = append(removed, systemFontsStyle...)
+	return append(removed, svg[end:]...)
+}
+
+// escapeXML escapes text the same way the D2 renderer does
+func escapeXML(text string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(text))
+	return buf.String()
 }
@@ -2,9 +2,15 @@ package parser_test
 
 import (
 	"html/template"
+	"strings"
 	"testing"
 
 	parse "github.com/kevineaton/d2tosite/parser"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
 )
 
 func TestProcessMarkdown(t *testing.T) {
@@ -27,7 +33,7 @@ func TestProcessMarkdown(t *testing.T) {
 		{
 			Input:               []byte("# Header\n\nHi!"),
 			Prefix:              "",
-			ExpectedHTMLContent: "<h1>Header</h1>\n<p>Hi!</p>\n",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p>Hi!</p>\n",
 			ExpectedTitle:       "Header",
 			ExpectedTags:        []string{},
 			ExpectAnError:       false,
@@ -35,7 +41,7 @@ func TestProcessMarkdown(t *testing.T) {
 		{
 			Input:               []byte("# Header\n\n{{sample}}"),
 			Prefix:              "",
-			ExpectedHTMLContent: "<h1>Header</h1>\n<p><img src='sample.svg' class='diagram-svg' alt='diagram' /></p>\n",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p><img src='sample.svg' class='diagram-svg' alt='diagram' /></p>\n",
 			ExpectedTitle:       "Header",
 			ExpectedTags:        []string{},
 			ExpectAnError:       false,
@@ -43,7 +49,7 @@ func TestProcessMarkdown(t *testing.T) {
 		{
 			Input:               []byte("# Header\n\n{{sample}}"),
 			Prefix:              "/",
-			ExpectedHTMLContent: "<h1>Header</h1>\n<p><img src='/sample.svg' class='diagram-svg' alt='diagram' /></p>\n",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p><img src='/sample.svg' class='diagram-svg' alt='diagram' /></p>\n",
 			ExpectedTitle:       "Header",
 			ExpectedTags:        []string{},
 			ExpectAnError:       false,
@@ -51,7 +57,7 @@ func TestProcessMarkdown(t *testing.T) {
 		{
 			Input:               []byte("# Header\n\n{{sample}}"),
 			Prefix:              "test",
-			ExpectedHTMLContent: "<h1>Header</h1>\n<p><img src='testsample.svg' class='diagram-svg' alt='diagram' /></p>\n",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p><img src='testsample.svg' class='diagram-svg' alt='diagram' /></p>\n",
 			ExpectedTitle:       "Header",
 			ExpectedTags:        []string{},
 			ExpectAnError:       false,
@@ -59,7 +65,31 @@ func TestProcessMarkdown(t *testing.T) {
 		{
 			Input:               []byte("# Header\n\n{{sample}}"),
 			Prefix:              "/test/2/",
-			ExpectedHTMLContent: "<h1>Header</h1>\n<p><img src='/test/2/sample.svg' class='diagram-svg' alt='diagram' /></p>\n",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p><img src='/test/2/sample.svg' class='diagram-svg' alt='diagram' /></p>\n",
+			ExpectedTitle:       "Header",
+			ExpectedTags:        []string{},
+			ExpectAnError:       false,
+		},
+		{
+			Input:               []byte("# Header\n\n{{sample inline}}\n\n{{other img}}"),
+			Prefix:              "/",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p><img src='/sample.svg' class='diagram-svg' alt='diagram' data-embed='inline' /></p>\n<p><img src='/other.svg' class='diagram-svg' alt='diagram' data-embed='img' /></p>\n",
+			ExpectedTitle:       "Header",
+			ExpectedTags:        []string{},
+			ExpectAnError:       false,
+		},
+		{
+			Input:               []byte("# Header\n\n{{sample inline nosource}}\n\n{{other nosource img}}\n\n{{third nosource}}"),
+			Prefix:              "/",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p><img src='/sample.svg' class='diagram-svg' alt='diagram' data-embed='inline' data-source='hidden' /></p>\n<p><img src='/other.svg' class='diagram-svg' alt='diagram' data-embed='img' data-source='hidden' /></p>\n<p><img src='/third.svg' class='diagram-svg' alt='diagram' data-source='hidden' /></p>\n",
+			ExpectedTitle:       "Header",
+			ExpectedTags:        []string{},
+			ExpectAnError:       false,
+		},
+		{
+			Input:               []byte("---\nd2_source: false\n---\n# Header\n\n{{sample inline}}"),
+			Prefix:              "/",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p><img src='/sample.svg' class='diagram-svg' alt='diagram' data-embed='inline' data-source='hidden' /></p>\n",
 			ExpectedTitle:       "Header",
 			ExpectedTags:        []string{},
 			ExpectAnError:       false,
@@ -67,7 +97,7 @@ func TestProcessMarkdown(t *testing.T) {
 		{
 			Input:               []byte("---\ntitle: Meta!\ntags:\n  - one\n  - two\n---\n# Header\n\n{{sample}}"),
 			Prefix:              "/test/2/",
-			ExpectedHTMLContent: "<h1>Header</h1>\n<p><img src='/test/2/sample.svg' class='diagram-svg' alt='diagram' /></p>\n",
+			ExpectedHTMLContent: "<h1 id=\"header\">Header</h1>\n<p><img src='/test/2/sample.svg' class='diagram-svg' alt='diagram' /></p>\n",
 			ExpectedTitle:       "Meta!",
 			ExpectedTags:        []string{"one", "two"},
 			ExpectAnError:       false,
@@ -76,7 +106,7 @@ func TestProcessMarkdown(t *testing.T) {
 
 	count := 0
 	for _, tt := range tests {
-		output, err := parse.ParseMD(tt.Input, tt.Prefix)
+		output, err := parse.ParseMD(tt.Input, tt.Prefix, nil)
 		if output.Content != tt.ExpectedHTMLContent {
 			t.Errorf("index %d: expected HTML of %s but found %s", count, tt.ExpectedHTMLContent, output.Content)
 		}
@@ -137,3 +167,106 @@ func TestProcessD2(t *testing.T) {
 		t.Errorf("expected to run %d test but only ran %d", len(tests), count)
 	}
 }
+
+func TestMarkdownExtensions(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Options     *parse.MarkdownOptions
+		Contains    []string
+		NotContains []string
+	}{
+		{
+			Input:    "| a | b |\n| - | - |\n| 1 | 2 |\n",
+			Contains: []string{"<table>", "<td>1</td>"},
+		},
+		{
+			Input:       "| a | b |\n| - | - |\n| 1 | 2 |\n",
+			Options:     &parse.MarkdownOptions{DisableTables: true},
+			NotContains: []string{"<table>"},
+		},
+		{
+			Input:    "~~gone~~ and https://example.com\n\n- [x] done\n- [ ] todo\n",
+			Contains: []string{"<del>gone</del>", `<a href="https://example.com">https://example.com</a>`, `<input checked="" disabled="" type="checkbox"`},
+		},
+		{
+			Input:       "~~gone~~ and https://example.com\n",
+			Options:     &parse.MarkdownOptions{DisableStrikethrough: true, DisableLinkify: true},
+			NotContains: []string{"<del>", "<a href"},
+		},
+		{
+			Input:    "Note[^1]\n\n[^1]: The footnote\n\nTerm\n: Definition\n",
+			Contains: []string{`class="footnote-ref"`, "<dl>", "<dd>Definition</dd>"},
+		},
+		{
+			Input:    "\"Quoted\" -- dashed\n",
+			Contains: []string{"&ldquo;Quoted&rdquo; &ndash; dashed"},
+		},
+		{
+			Input:    "\"Quoted\"\n",
+			Options:  &parse.MarkdownOptions{DisableTypographer: true},
+			Contains: []string{"&quot;Quoted&quot;"},
+		},
+		{
+			Input:       "one\ntwo\n\n<span>raw</span>\n",
+			NotContains: []string{"<br>", "<span>raw</span>"},
+		},
+		{
+			Input:    "one\ntwo\n\n<span>raw</span>\n",
+			Options:  &parse.MarkdownOptions{HardWraps: true, Unsafe: true},
+			Contains: []string{"one<br>", "<span>raw</span>"},
+		},
+		{
+			Input:    "one\ntwo\n",
+			Options:  &parse.MarkdownOptions{HardWraps: true, XHTML: true},
+			Contains: []string{"one<br />"},
+		},
+	}
+	for i, tt := range tests {
+		output, err := parse.ParseMD([]byte(tt.Input), "/", tt.Options)
+		if err != nil {
+			t.Errorf("index %d: unexpected error: %v", i, err)
+			continue
+		}
+		for _, expected := range tt.Contains {
+			if !strings.Contains(string(output.Content), expected) {
+				t.Errorf("index %d: expected output to contain %s but found %s", i, expected, output.Content)
+			}
+		}
+		for _, unexpected := range tt.NotContains {
+			if strings.Contains(string(output.Content), unexpected) {
+				t.Errorf("index %d: expected output to not contain %s but found %s", i, unexpected, output.Content)
+			}
+		}
+	}
+}
+
+// kbdExtension is a small goldmark extension to make sure library users can add their own
+type kbdExtension struct{}
+
+func (e *kbdExtension) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 1)))
+}
+
+func (e *kbdExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindCodeSpan, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString("<kbd>")
+			_, _ = w.Write(n.Text(source))
+			_, _ = w.WriteString("</kbd>")
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+func TestMarkdownCustomExtensions(t *testing.T) {
+	output, err := parse.ParseMD([]byte("# Custom\n\nPress `ctrl`\ntwo\n"), "/", &parse.MarkdownOptions{
+		Extensions:      []goldmark.Extender{&kbdExtension{}},
+		RendererOptions: []renderer.Option{html.WithHardWraps()},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(output.Content), "Press <kbd>ctrl</kbd><br>") {
+		t.Errorf("expected the custom extension and renderer option to be used: %s", output.Content)
+	}
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/lexers"
+)
+
+// d2Lexer highlights D2, which chroma doesn't know about; registering it means ```d2 code blocks
+// are highlighted the same as the source on a diagram's page
+var d2Lexer = lexers.Register(chroma.MustNewLazyLexer(
+	&chroma.Config{
+		Name:      "D2",
+		Aliases:   []string{"d2"},
+		Filenames: []string{"*.d2"},
+		MimeTypes: []string{"text/x-d2"},
+	},
+	d2Rules,
+))
+
+// d2Keywords are the reserved keys, which are only keywords when used as a key
+var d2Keywords = []string{
+	"shape", "label", "style", "link", "tooltip", "icon", "near", "direction", "width", "height",
+	"constraint", "source-arrowhead", "target-arrowhead", "opacity", "fill", "stroke", "stroke-width",
+	"stroke-dash", "border-radius", "shadow", "3d", "multiple", "font", "font-size", "font-color",
+	"bold", "italic", "underline", "animated", "filled",
+}
+
+func d2Rules() chroma.Rules {
+	return chroma.Rules{
+		"root": {
+			{Pattern: `\s+`, Type: chroma.Text},
+			{Pattern: `#.*`, Type: chroma.Comment},
+			{Pattern: `"(\\\\|\\"|[^"])*"`, Type: chroma.StringDouble},
+			{Pattern: `'(\\\\|\\'|[^'])*'`, Type: chroma.StringSingle},
+			{Pattern: `\|[a-zA-Z]*\n[\s\S]*?\n\s*\|`, Type: chroma.StringHeredoc},
+			{Pattern: `<->|->|<-|--`, Type: chroma.Operator},
+			{Pattern: chroma.Words(`(?<![\w-])`, `(?=\s*[:.{])`, d2Keywords...), Type: chroma.Keyword},
+			{Pattern: chroma.Words(`\b`, `\b`, "true", "false", "null"), Type: chroma.KeywordConstant},
+			{Pattern: `-?\d+(\.\d+)?\b`, Type: chroma.LiteralNumber},
+			{Pattern: `[:;.{}]`, Type: chroma.Punctuation},
+			{Pattern: `\w+(?:-\w+)*`, Type: chroma.Name},
+			{Pattern: `.`, Type: chroma.Text},
+		},
+	}
+}
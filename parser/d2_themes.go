@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2exporter"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/d2themes"
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+)
+
+// darkThemeStart is the ID D2 starts its dark themes at
+const darkThemeStart = 200
+
+// svgOpeningTagRegex finds the opening tag of the SVG, which holds the background the D2 renderer sets
+var svgOpeningTagRegex = regexp.MustCompile(`<svg\b[^>]*>`)
+
+// svgBackgroundRegex finds the background in the style of the SVG's opening tag
+var svgBackgroundRegex = regexp.MustCompile(`background:\s*[^;"]*`)
+
+// svgTextFillRegex finds the black the D2 renderer falls back to for text it wasn't given a color for
+var svgTextFillRegex = regexp.MustCompile(`(<text\b[^>]*\bstyle="[^"]*\bfill:)black\b`)
+
+// DarkMauve is the dark theme from later versions of D2, which the version this is built against
+// doesn't have yet. It is kept here with any other themes missing from D2's catalog.
+var DarkMauve = d2themes.Theme{
+	ID:   200,
+	Name: "Dark Mauve",
+	Colors: d2themes.ColorPalette{
+		Neutrals: d2themes.Neutral{
+			N1: "#CDD6F4",
+			N2: "#BAC2DE",
+			N3: "#A6ADC8",
+			N4: "#585B70",
+			N5: "#45475A",
+			N6: "#313244",
+			N7: "#1E1E2E",
+		},
+		B1:  "#CBA6F7",
+		B2:  "#CBA6F7",
+		B3:  "#6C7086",
+		B4:  "#585B70",
+		B5:  "#45475A",
+		B6:  "#313244",
+		AA2: "#F38BA8",
+		AA4: "#45475A",
+		AA5: "#313244",
+		AB4: "#45475A",
+		AB5: "#313244",
+	},
+}
+
+// extraThemes are the themes that can be used along with the ones in D2's catalog
+var extraThemes = []d2themes.Theme{DarkMauve}
+
+// findD2Theme finds a theme in D2's catalog or in the extra themes, and whether it is in the catalog;
+// a theme that isn't known has no name
+func findD2Theme(id int64) (d2themes.Theme, bool) {
+	for _, theme := range d2themescatalog.Catalog {
+		if theme.ID == id {
+			return theme, true
+		}
+	}
+	for _, theme := range extraThemes {
+		if theme.ID == id {
+			return theme, false
+		}
+	}
+	return d2themes.Theme{}, false
+}
+
+// D2ThemeID finds the ID of a D2 theme from either its ID, such as 6, or its name, such as Grape Soda.
+// Names ignore case, spaces, dashes, and underscores, so grape-soda works where spaces can't be used.
+func D2ThemeID(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if D2ThemeName(id) == "" {
+			return 0, fmt.Errorf("D2 theme %d is not known", id)
+		}
+		return id, nil
+	}
+	for _, themes := range [][]d2themes.Theme{d2themescatalog.Catalog, extraThemes} {
+		for _, theme := range themes {
+			if normalizeThemeName(theme.Name) == normalizeThemeName(value) {
+				return theme.ID, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("D2 theme '%s' is not known", value)
+}
+
+// D2ThemeName finds the name of a D2 theme from its ID, or an empty string if it isn't known
+func D2ThemeName(id int64) string {
+	theme, _ := findD2Theme(id)
+	return theme.Name
+}
+
+// normalizeThemeName drops everything from a theme name that a person might write differently
+func normalizeThemeName(name string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// isDarkTheme checks if the theme is one of the dark themes, which D2 numbers from 200
+func isDarkTheme(id int64) bool {
+	return id >= darkThemeStart && D2ThemeName(id) != ""
+}
+
+// applyDarkTheme swaps the white background the D2 renderer always gives the SVG, and the black it falls
+// back to for text without a color, for the theme's own colors
+func applyDarkTheme(svg []byte, theme d2themes.Theme) []byte {
+	neutrals := theme.Colors.Neutrals
+	if root := svgOpeningTagRegex.FindIndex(svg); root != nil {
+		tag := svg[root[0]:root[1]]
+		background := []byte(fmt.Sprintf("background: %s", neutrals.N7))
+		switch {
+		case svgBackgroundRegex.Match(tag):
+			tag = svgBackgroundRegex.ReplaceAll(tag, background)
+		case bytes.Contains(tag, []byte(` style="`)):
+			tag = bytes.Replace(tag, []byte(` style="`), []byte(fmt.Sprintf(` style="%s; `, background)), 1)
+		default:
+			tag = bytes.Replace(tag, []byte("<svg"), []byte(fmt.Sprintf(`<svg style="%s;"`, background)), 1)
+		}
+		svg = append(append(append([]byte{}, svg[:root[0]]...), tag...), svg[root[1]:]...)
+	}
+	return svgTextFillRegex.ReplaceAll(svg, []byte("${1}"+neutrals.N1))
+}
+
+// exportTheme exports the laid out graph with a theme that isn't in D2's catalog, since D2's exporter
+// can only find themes by ID. The colors are filled in the same way the exporter does, keeping any
+// set by the styles in the D2.
+func exportTheme(graph *d2graph.Graph, theme d2themes.Theme) (*d2target.Diagram, error) {
+	diagram, err := d2exporter.Export(context.Background(), graph, theme.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i, obj := range graph.Objects {
+		shape := &diagram.Shapes[i]
+		style := obj.Attributes.Style
+		shape.Stroke = obj.GetStroke(&theme, shape.StrokeDash)
+		if style.Stroke != nil {
+			shape.Stroke = style.Stroke.Value
+		}
+		shape.Fill = obj.GetFill(&theme)
+		if style.Fill != nil {
+			shape.Fill = style.Fill.Value
+		} else if obj.Attributes.Shape.Value == d2target.ShapeText {
+			shape.Fill = "transparent"
+		}
+		shape.Color = obj.Text().GetColor(&theme, shape.Italic)
+		if style.FontColor != nil {
+			shape.Color = style.FontColor.Value
+		}
+	}
+	for i, edge := range graph.Edges {
+		connection := &diagram.Connections[i]
+		style := edge.Attributes.Style
+		connection.Stroke = edge.GetStroke(&theme, connection.StrokeDash)
+		if style.Stroke != nil {
+			connection.Stroke = style.Stroke.Value
+		}
+		connection.Color = edge.Text().GetColor(&theme, connection.Italic)
+		if style.FontColor != nil {
+			connection.Color = style.FontColor.Value
+		}
+	}
+	return diagram, nil
+}
@@ -0,0 +1,65 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+)
+
+func TestCompileD2Themes(t *testing.T) {
+	input := []byte("a: Start\na -> b: next\nb.link: https://example.com\nc.style.fill: \"#123456\"")
+	rendered, data, err := parse.CompileD2Themes(input, &parse.ParseOptions{D2Pad: 20}, 1, parse.DarkMauve.ID)
+	if err != nil {
+		t.Fatalf("could not compile the diagram: %v", err)
+	}
+	if len(rendered) != 2 {
+		t.Fatalf("expected a rendering for each theme but found %d", len(rendered))
+	}
+	light, dark := string(rendered[0]), string(rendered[1])
+	if data.Theme != 1 || data.ThemeName != "Neutral Grey" {
+		t.Errorf("expected the data to describe the first theme: %+v", data)
+	}
+
+	// the same layout is used for both, so only the colors change
+	single, _, err := parse.CompileD2(input, &parse.ParseOptions{D2Theme: 1, D2Pad: 20})
+	if err != nil {
+		t.Fatalf("could not compile the diagram: %v", err)
+	}
+	if light != string(single) {
+		t.Errorf("expected the first theme to render the same as compiling it alone")
+	}
+	lightSize, _ := parse.SVGSize(rendered[0])
+	darkSize, _ := parse.SVGSize(rendered[1])
+	if lightSize != darkSize {
+		t.Errorf("expected both themes to be the same size but found %v and %v", lightSize, darkSize)
+	}
+	if !strings.Contains(light, `style="background: white;"`) || !strings.Contains(light, "fill:#0A0F25") {
+		t.Errorf("expected the light theme to keep the white background and its own text color")
+	}
+	for _, expected := range []string{`style="background: #1E1E2E;"`, "fill:#CDD6F4", "#CBA6F7", "#123456", `<a href="https://example.com"`} {
+		if !strings.Contains(dark, expected) {
+			t.Errorf("expected the dark theme to contain %s", expected)
+		}
+	}
+	if strings.Contains(dark, "fill:black") {
+		t.Errorf("expected the dark theme not to have black text")
+	}
+
+	if _, _, err := parse.CompileD2Themes(input, nil); err == nil {
+		t.Errorf("expected compiling without a theme to be an error")
+	}
+	if id, err := parse.D2ThemeID("dark-mauve"); err != nil || id != 200 {
+		t.Errorf("expected the dark theme to be known but found %d and %v", id, err)
+	}
+	if d2themescatalog.Find(parse.DarkMauve.ID).Name != "" {
+		t.Errorf("expected D2's own catalog to be left alone")
+	}
+
+	// the dark theme can also be the only one
+	rendered, _, err = parse.CompileD2Themes(input, nil, parse.DarkMauve.ID)
+	if err != nil || !strings.Contains(string(rendered[0]), "#CBA6F7") || !strings.Contains(string(rendered[0]), `style="background: #1E1E2E;"`) {
+		t.Errorf("expected the dark theme to be used on its own: %v", err)
+	}
+}
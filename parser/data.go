@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadData reads every .yaml, .yml, .json, and .toml file in the directory into a tree keyed by the
+// file name without the extension, with each directory becoming a nested map, so data/services/owners.yaml
+// is at services.owners. A directory that doesn't exist has no data.
+func LoadData(directory string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	entries, err := os.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return data, err
+	}
+	for _, entry := range entries {
+		file := filepath.Join(directory, entry.Name())
+		if entry.IsDir() {
+			nested, err := LoadData(file)
+			if err != nil {
+				return data, err
+			}
+			err = addData(data, entry.Name(), nested, file)
+			if err != nil {
+				return data, err
+			}
+			continue
+		}
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+		if extension != ".yaml" && extension != ".yml" && extension != ".json" && extension != ".toml" {
+			continue
+		}
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return data, err
+		}
+		var value interface{}
+		switch extension {
+		case ".json":
+			err = json.Unmarshal(contents, &value)
+		case ".toml":
+			table := map[string]interface{}{}
+			_, err = toml.Decode(string(contents), &table)
+			value = table
+		default:
+			err = yaml.Unmarshal(contents, &value)
+		}
+		if err != nil {
+			return data, fmt.Errorf("data %s: %v", file, err)
+		}
+		err = addData(data, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())), normalizeFrontMatterValue(value), file)
+		if err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+// addData sets the key, making sure two files, or a file and a directory, don't both claim it
+func addData(data map[string]interface{}, key string, value interface{}, file string) error {
+	if _, found := data[key]; found {
+		return fmt.Errorf("data %s: more than one file or directory is named %s", file, key)
+	}
+	data[key] = value
+	return nil
+}
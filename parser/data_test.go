@@ -0,0 +1,77 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestLoadData(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"environments.json":     `["dev", "staging", "prod"]`,
+		"services/owners.yaml":  "billing:\n  team: payments\n  oncall: pay-oncall\n",
+		"services/regions.toml": "primary = \"us-east-1\"\n",
+		"notes.txt":             "not data",
+	}
+	for name, contents := range files {
+		file := filepath.Join(directory, name)
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := parse.LoadData(directory)
+	if err != nil {
+		t.Fatalf("could not load the data: %v", err)
+	}
+	if environments, ok := data["environments"].([]interface{}); !ok || len(environments) != 3 {
+		t.Errorf("expected the JSON list to be loaded but found %v", data["environments"])
+	}
+	services, ok := data["services"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected the directory to be a nested map but found %v", data)
+	}
+	owners, _ := services["owners"].(map[string]interface{})
+	billing, _ := owners["billing"].(map[string]interface{})
+	if billing["team"] != "payments" {
+		t.Errorf("expected the YAML to be loaded into string keyed maps but found %v", services["owners"])
+	}
+	regions, _ := services["regions"].(map[string]interface{})
+	if regions["primary"] != "us-east-1" {
+		t.Errorf("expected the TOML to be loaded but found %v", services["regions"])
+	}
+	if _, found := data["notes"]; found {
+		t.Errorf("expected files that aren't data to be skipped")
+	}
+
+	data, err = parse.LoadData(filepath.Join(directory, "missing"))
+	if err != nil || len(data) != 0 {
+		t.Errorf("expected a missing directory to have no data: %v %v", err, data)
+	}
+
+	err = os.WriteFile(filepath.Join(directory, "environments.yaml"), []byte("- dev\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parse.LoadData(directory)
+	if err == nil || !strings.Contains(err.Error(), "more than one file or directory is named environments") {
+		t.Errorf("expected an error for the duplicate name but found %v", err)
+	}
+	os.Remove(filepath.Join(directory, "environments.yaml"))
+
+	err = os.WriteFile(filepath.Join(directory, "broken.json"), []byte(`{"team": `), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parse.LoadData(directory)
+	if err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("expected an error naming the broken file but found %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package parser
+
+import (
+	"html/template"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// DiagramData describes a compiled diagram, so templates can render captions, stats, and legends
+type DiagramData struct {
+	Source          string          // the site path of the source, such as /flows/login.d2
+	Path            string          // the site path of the SVG, such as /flows/login.svg
+	DarkPath        string          // the site path of the SVG in the dark theme, such as /flows/login.dark.svg, if there is one
+	PagePath        string          // the site path of the diagram's own page, such as /diagrams/flows/login.html
+	DownloadPath    string          // the site path the source is published to next to the SVG, such as /flows/login.d2, with --d2-source
+	Code            template.HTML   // the highlighted source, if it is published next to the SVG to show with the embeds
+	Size            DiagramSize     // the size of the SVG; zero if it couldn't be read
+	Shapes          int             // the number of shapes, including containers
+	Connections     int             // the number of connections between the shapes
+	Labels          []string        // the distinct labels of the shapes, sorted
+	Theme           int64           // the D2 theme ID it was compiled with
+	ThemeName       string          // the name of the theme, such as Grape soda
+	Layout          string          // the layout engine it was compiled with, such as dagre
+	Converter       string          // the command that converted it, for diagrams in other languages
+	CompileDuration time.Duration   // how long it took to compile
+	JSONPath        string          // the site path of the exported Model, such as /flows/login.d2.json, if it was written
+	Model           *DiagramModel   // the compiled diagram, for D2 diagrams
+	Entities        []DiagramEntity // the shapes and where they are drawn, for D2 diagrams
+}
+
+// DiagramEntity is a shape drawn in a diagram, so a site can index the things its diagrams show
+type DiagramEntity struct {
+	ID    string    // the full ID, such as store.db
+	Label string    // the label, which is the ID unless one was given
+	Shape string    // the type of shape, such as rectangle, cylinder, or text
+	Box   EntityBox // where the shape is drawn in the SVG
+}
+
+// EntityBox is where a shape is drawn, as percentages of the size of the SVG, so it can be highlighted
+// over the image at any size
+type EntityBox struct {
+	Left   float64
+	Top    float64
+	Width  float64
+	Height float64
+}
+
+// DiagramModel is a compiled D2 diagram, with the geometry of every shape and connection along with
+// a summary of the graph, so other tools can use the diagram without parsing the D2
+type DiagramModel struct {
+	Diagram *d2target.Diagram `json:"diagram"` // the shapes and connections as D2 renders them, with their positions, links, and tooltips
+	Graph   GraphSummary      `json:"graph"`
+}
+
+// GraphSummary is the structure of a diagram without any of the geometry or styles
+type GraphSummary struct {
+	Shapes      []GraphShape      `json:"shapes"`
+	Connections []GraphConnection `json:"connections"`
+}
+
+// GraphShape is a shape in the GraphSummary
+type GraphShape struct {
+	ID      string `json:"id"`               // the full ID, such as store.db
+	Label   string `json:"label"`            // the label, which is the ID unless one was given
+	Shape   string `json:"shape"`            // the type of shape, such as rectangle or cylinder
+	Parent  string `json:"parent,omitempty"` // the full ID of the container it is in, if any
+	Link    string `json:"link,omitempty"`
+	Tooltip string `json:"tooltip,omitempty"`
+}
+
+// GraphConnection is a connection between two shapes in the GraphSummary
+type GraphConnection struct {
+	ID          string `json:"id"`     // the ID D2 gives the connection, such as (a -> b)[0]
+	Source      string `json:"source"` // the full ID of the shape it starts from
+	Target      string `json:"target"` // the full ID of the shape it goes to
+	Label       string `json:"label,omitempty"`
+	SourceArrow bool   `json:"source_arrow"` // whether there is an arrowhead at the source
+	TargetArrow bool   `json:"target_arrow"` // whether there is an arrowhead at the target
+}
+
+// describeGraph counts the shapes and connections of the compiled graph and collects the labels for a legend
+func describeGraph(graph *d2graph.Graph) *DiagramData {
+	data := &DiagramData{
+		Labels: []string{},
+	}
+	if graph == nil {
+		return data
+	}
+	data.Shapes = len(graph.Objects)
+	data.Connections = len(graph.Edges)
+	seen := map[string]bool{}
+	for _, object := range graph.Objects {
+		label := object.Attributes.Label.Value
+		if label != "" && !seen[label] {
+			seen[label] = true
+			data.Labels = append(data.Labels, label)
+		}
+	}
+	sort.Strings(data.Labels)
+	return data
+}
+
+// summarizeGraph lists the shapes and connections of the compiled graph by their IDs
+func summarizeGraph(graph *d2graph.Graph) GraphSummary {
+	summary := GraphSummary{
+		Shapes:      []GraphShape{},
+		Connections: []GraphConnection{},
+	}
+	if graph == nil {
+		return summary
+	}
+	for _, object := range graph.Objects {
+		shape := GraphShape{
+			ID:      object.AbsID(),
+			Label:   object.Attributes.Label.Value,
+			Shape:   object.Attributes.Shape.Value,
+			Link:    object.Attributes.Link,
+			Tooltip: object.Attributes.Tooltip,
+		}
+		if shape.Shape == "" {
+			shape.Shape = d2target.ShapeRectangle
+		}
+		if object.Parent != nil && object.Parent != graph.Root {
+			shape.Parent = object.Parent.AbsID()
+		}
+		summary.Shapes = append(summary.Shapes, shape)
+	}
+	for _, edge := range graph.Edges {
+		summary.Connections = append(summary.Connections, GraphConnection{
+			ID:          edge.AbsID(),
+			Source:      edge.Src.AbsID(),
+			Target:      edge.Dst.AbsID(),
+			Label:       edge.Attributes.Label.Value,
+			SourceArrow: edge.SrcArrow,
+			TargetArrow: edge.DstArrow,
+		})
+	}
+	return summary
+}
+
+// locateEntities lists the shapes of the diagram with their boxes, using the same bounds and padding
+// as the SVG's viewBox
+func locateEntities(diagram *d2target.Diagram, pad int) []DiagramEntity {
+	entities := []DiagramEntity{}
+	if diagram == nil {
+		return entities
+	}
+	topLeft, bottomRight := diagram.BoundingBox()
+	width := float64(bottomRight.X - topLeft.X + pad*2)
+	height := float64(bottomRight.Y - topLeft.Y + pad*2)
+	if width <= 0 || height <= 0 {
+		return entities
+	}
+	for _, shape := range diagram.Shapes {
+		entity := DiagramEntity{
+			ID:    shape.ID,
+			Label: shape.Label,
+			Shape: shape.Type,
+			Box: EntityBox{
+				Left:   roundPercent(float64(shape.Pos.X-topLeft.X+pad) / width),
+				Top:    roundPercent(float64(shape.Pos.Y-topLeft.Y+pad) / height),
+				Width:  roundPercent(float64(shape.Width) / width),
+				Height: roundPercent(float64(shape.Height) / height),
+			},
+		}
+		if entity.Label == "" {
+			entity.Label = shape.ID[strings.LastIndex(shape.ID, ".")+1:]
+		}
+		if entity.Shape == "" {
+			entity.Shape = d2target.ShapeRectangle
+		}
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+// roundPercent turns the fraction into a percentage to two places, which is plenty for a highlight
+func roundPercent(fraction float64) float64 {
+	return math.Round(fraction*10000) / 100
+}
@@ -0,0 +1,270 @@
+package parser_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestCompileD2(t *testing.T) {
+	svg, data, err := parse.CompileD2([]byte("api: API Gateway\napi -> db: reads\napi -> cache\nstore: {\n  db\n}\n"), &parse.ParseOptions{D2Theme: 3, D2Layout: "ELK"})
+	if err != nil {
+		t.Fatalf("could not compile the diagram: %v", err)
+	}
+	if !strings.Contains(string(svg), "<svg") {
+		t.Errorf("expected an SVG but found %s", svg)
+	}
+	if data.Shapes != 5 || data.Connections != 2 {
+		t.Errorf("expected 5 shapes and 2 connections but found %d and %d", data.Shapes, data.Connections)
+	}
+	if strings.Join(data.Labels, ",") != "API Gateway,cache,db,store" {
+		t.Errorf("expected the labels sorted without duplicates but found %v", data.Labels)
+	}
+	if data.Theme != 3 || data.Layout != "elk" || data.CompileDuration <= 0 {
+		t.Errorf("expected the theme, layout, and duration to be set: %+v", data)
+	}
+	if data.Size.Width == 0 || data.Size.Height == 0 {
+		t.Errorf("expected the size to be read from the SVG: %+v", data.Size)
+	}
+
+	_, data, err = parse.CompileD2([]byte("a -> "), nil)
+	if err == nil || data != nil {
+		t.Errorf("expected the broken diagram to be an error without data but found %v and %+v", err, data)
+	}
+}
+
+func TestCompileD2Options(t *testing.T) {
+	input := []byte("a: Start\nb: Finish\nc\na -> b\na -> c\n")
+	base, data, err := parse.CompileD2(input, &parse.ParseOptions{D2Theme: 1})
+	if err != nil {
+		t.Fatalf("could not compile the diagram: %v", err)
+	}
+	if data.ThemeName != "Neutral Grey" {
+		t.Errorf("expected the theme's name but found %s", data.ThemeName)
+	}
+	size, _ := parse.SVGSize(base)
+
+	tests := []struct {
+		Name    string
+		Options *parse.ParseOptions
+		Check   func(svg []byte) string
+	}{
+		{
+			Name:    "theme",
+			Options: &parse.ParseOptions{D2Theme: 6},
+			Check: func(svg []byte) string {
+				if string(svg) == string(base) {
+					return "expected a different theme to change the colors"
+				}
+				return ""
+			},
+		},
+		{
+			Name:    "layout",
+			Options: &parse.ParseOptions{D2Theme: 1, D2Layout: "elk"},
+			Check: func(svg []byte) string {
+				if string(svg) == string(base) {
+					return "expected elk to lay the diagram out differently"
+				}
+				return ""
+			},
+		},
+		{
+			Name:    "padding",
+			Options: &parse.ParseOptions{D2Theme: 1, D2Pad: 20},
+			Check: func(svg []byte) string {
+				padded, _ := parse.SVGSize(svg)
+				if padded.Width != size.Width-160 || padded.Height != size.Height-160 {
+					return "expected the padding to shrink the diagram by 80 on each side"
+				}
+				return ""
+			},
+		},
+		{
+			Name:    "no padding",
+			Options: &parse.ParseOptions{D2Theme: 1, D2Pad: -1},
+			Check: func(svg []byte) string {
+				padded, _ := parse.SVGSize(svg)
+				if padded.Width != size.Width-200 || padded.Height != size.Height-200 {
+					return "expected the padding to be removed"
+				}
+				return ""
+			},
+		},
+		{
+			Name:    "fonts",
+			Options: &parse.ParseOptions{D2Theme: 1, D2DisableFonts: true},
+			Check: func(svg []byte) string {
+				if strings.Contains(string(svg), "@font-face") || len(svg) >= len(base)/2 {
+					return "expected the fonts to be left out"
+				}
+				if !strings.Contains(string(svg), "sans-serif") || !strings.HasSuffix(string(svg), "</svg>") {
+					return "expected the text to use the reader's fonts"
+				}
+				return ""
+			},
+		},
+	}
+	for _, test := range tests {
+		svg, _, err := parse.CompileD2(input, test.Options)
+		if err != nil {
+			t.Errorf("%s: could not compile the diagram: %v", test.Name, err)
+			continue
+		}
+		if message := test.Check(svg); message != "" {
+			t.Errorf("%s: %s", test.Name, message)
+		}
+	}
+}
+
+func TestD2ThemeID(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"6":              6,
+		"Grape Soda":     6,
+		"grape-soda":     6,
+		"buttered_toast": 105,
+		" 0 ":            0,
+	} {
+		id, err := parse.D2ThemeID(value)
+		if err != nil || id != expected {
+			t.Errorf("expected %s to be %d but found %d and %v", value, expected, id, err)
+		}
+	}
+	for _, value := range []string{"2", "lemonade", ""} {
+		if _, err := parse.D2ThemeID(value); err == nil {
+			t.Errorf("expected %s not to be a theme", value)
+		}
+	}
+}
+
+func TestCompileD2Entities(t *testing.T) {
+	input := []byte("api: API\nstore: {\n  db: Database\n}\napi -> store.db\n")
+	svg, data, err := parse.CompileD2(input, &parse.ParseOptions{D2Pad: 20})
+	if err != nil {
+		t.Fatalf("could not compile the diagram: %v", err)
+	}
+	if len(data.Entities) != 3 {
+		t.Fatalf("expected an entity for each shape but found %+v", data.Entities)
+	}
+	labels := map[string]string{}
+	for _, entity := range data.Entities {
+		labels[entity.ID] = entity.Label
+		if entity.Shape != "rectangle" {
+			t.Errorf("expected %s to be a rectangle but found %s", entity.ID, entity.Shape)
+		}
+		box := entity.Box
+		if box.Left < 0 || box.Top < 0 || box.Width <= 0 || box.Height <= 0 || box.Left+box.Width > 100 || box.Top+box.Height > 100 {
+			t.Errorf("expected %s to be inside the SVG but found %+v", entity.ID, box)
+		}
+	}
+	if labels["api"] != "API" || labels["store"] != "store" || labels["store.db"] != "Database" {
+		t.Errorf("expected the IDs and labels of the shapes but found %v", labels)
+	}
+
+	// the container holds the shape inside it, and nothing is drawn in the padding
+	var store, db parse.EntityBox
+	for _, entity := range data.Entities {
+		switch entity.ID {
+		case "store":
+			store = entity.Box
+		case "store.db":
+			db = entity.Box
+		}
+	}
+	if db.Left <= store.Left || db.Top <= store.Top || db.Left+db.Width >= store.Left+store.Width {
+		t.Errorf("expected %+v to be inside %+v", db, store)
+	}
+	size, _ := parse.SVGSize(svg)
+	for _, entity := range data.Entities {
+		if entity.Box.Left*float64(size.Width)/100 < 19 || entity.Box.Top*float64(size.Height)/100 < 19 {
+			t.Errorf("expected %s to start after the padding but found %+v in %v", entity.ID, entity.Box, size)
+		}
+	}
+}
+
+func TestCompileD2Model(t *testing.T) {
+	input := []byte("api: API\napi.link: https://example.com/api\napi.tooltip: The public API\nstore: {\n  db: Database {\n    shape: cylinder\n  }\n}\napi -> store.db: reads\n")
+	_, data, err := parse.CompileD2(input, nil)
+	if err != nil {
+		t.Fatalf("could not compile the diagram: %v", err)
+	}
+	if data.Model == nil || data.Model.Diagram == nil {
+		t.Fatalf("expected the compiled model to be kept")
+	}
+	if len(data.Model.Diagram.Shapes) != 3 || len(data.Model.Diagram.Connections) != 1 {
+		t.Errorf("expected the shapes and connections to be in the diagram: %+v", data.Model.Diagram)
+	}
+
+	expectedShapes := map[string]parse.GraphShape{
+		"api":      {ID: "api", Label: "API", Shape: "rectangle", Link: "https://example.com/api", Tooltip: "The public API"},
+		"store":    {ID: "store", Label: "store", Shape: "rectangle"},
+		"store.db": {ID: "store.db", Label: "Database", Shape: "cylinder", Parent: "store"},
+	}
+	if len(data.Model.Graph.Shapes) != len(expectedShapes) {
+		t.Errorf("expected %d shapes but found %+v", len(expectedShapes), data.Model.Graph.Shapes)
+	}
+	for _, shape := range data.Model.Graph.Shapes {
+		if shape != expectedShapes[shape.ID] {
+			t.Errorf("expected %+v but found %+v", expectedShapes[shape.ID], shape)
+		}
+	}
+	expectedConnection := parse.GraphConnection{ID: "(api -> store.db)[0]", Source: "api", Target: "store.db", Label: "reads", TargetArrow: true}
+	if len(data.Model.Graph.Connections) != 1 || data.Model.Graph.Connections[0] != expectedConnection {
+		t.Errorf("expected %+v but found %+v", expectedConnection, data.Model.Graph.Connections)
+	}
+
+	encoded, err := json.Marshal(data.Model)
+	if err != nil {
+		t.Fatalf("could not encode the model: %v", err)
+	}
+	for _, expected := range []string{`"diagram":{`, `"pos":{`, `"graph":{"shapes":[`, `"target_arrow":true`} {
+		if !strings.Contains(string(encoded), expected) {
+			t.Errorf("expected the JSON to contain %s but found %s", expected, encoded)
+		}
+	}
+}
+
+func TestCompileD2ResolveLink(t *testing.T) {
+	input := []byte("api: {\n  link: ../services/api.md\n}\nweb.link: https://example.com\napi -> web\n")
+	links := &testLinkResolver{}
+	rendered, data, err := parse.CompileD2Themes(input, &parse.ParseOptions{Links: links}, 1, 200)
+	if err != nil {
+		t.Fatalf("could not compile the diagram: %v", err)
+	}
+	if len(links.resolved) != 2 {
+		t.Errorf("expected each link to be resolved once but found %v", links.resolved)
+	}
+	for i, svg := range rendered {
+		if !strings.Contains(string(svg), `<a href="/services/api.html"`) || !strings.Contains(string(svg), `<a href="https://example.com"`) {
+			t.Errorf("theme %d: expected the SVG to have the resolved links", i)
+		}
+		if strings.Contains(string(svg), "api.md") {
+			t.Errorf("theme %d: expected the source link to be replaced", i)
+		}
+	}
+	for _, shape := range data.Model.Diagram.Shapes {
+		if shape.ID == "api" && shape.Link != "/services/api.html" {
+			t.Errorf("expected the model to have the resolved link but found %s", shape.Link)
+		}
+	}
+	for _, shape := range data.Model.Graph.Shapes {
+		if shape.ID == "api" && shape.Link != "/services/api.html" {
+			t.Errorf("expected the graph summary to have the resolved link but found %s", shape.Link)
+		}
+	}
+}
+
+// testLinkResolver points the link to the API's page at its HTML and records every link it is given
+type testLinkResolver struct {
+	resolved []string
+}
+
+func (links *testLinkResolver) ResolveLink(link string) string {
+	links.resolved = append(links.resolved, link)
+	if link == "../services/api.md" {
+		return "/services/api.html"
+	}
+	return link
+}
@@ -0,0 +1,316 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// jsonFrontMatterRegex finds a JSON object at the top of the content; the first key is required so
+// a diagram embed or an include at the top of the page, such as {{flow}}, isn't mistaken for JSON
+var jsonFrontMatterRegex = regexp.MustCompile(`^{\s*("|})`)
+
+// FrontMatter is the meta data that can be provided at the top of a Markdown file. Each
+// known key is decoded into its typed field; any key that isn't known is kept in Params along
+// with anything provided under the params key so templates can still reach it
+type FrontMatter struct {
+	Title       string                 // title: the title of the page; falls back to the first <h1>
+	Summary     string                 // summary: a plain text summary used for search
+	Description string                 // description: a longer description, such as for a meta tag
+	Tags        []string               // tags: a list of tags, or a single tag as a string
+	Keywords    []string               // keywords: a list of keywords, or a single keyword as a string
+	Authors     []string               // authors: a list of authors, or a single author as a string
+	Date        time.Time              // date: when the page was written
+	Updated     time.Time              // updated: when the page was last changed
+	Draft       bool                   // draft: whether the page is a draft
+	PublishDate time.Time              // publish_date: the page is not published before this date
+	Weight      int                    // weight: used for ordering pages
+	Aliases     []string               // aliases: other paths the page may be reached at
+	Layout      string                 // layout: the name of the layout a template may choose
+	TOC         bool                   // toc: whether to build the table of contents, defaults to true
+	D2Theme     *int64                 // d2_theme: the D2 theme ID or name for the diagrams this page embeds, nil if not set since 0 is a theme
+	D2Layout    string                 // d2_layout: the D2 layout engine for the diagrams this page embeds
+	D2Source    bool                   // d2_source: whether the source of the diagrams this page embeds may be shown, defaults to true
+	Params      map[string]interface{} // params: anything else the templates may want
+}
+
+// FrontMatterError is returned when a front matter key has a value of the wrong type
+type FrontMatterError struct {
+	Key     string
+	Message string
+}
+
+func (err *FrontMatterError) Error() string {
+	return fmt.Sprintf("front matter key '%s': %s", err.Key, err.Message)
+}
+
+// the layouts that are accepted for the date keys, in order
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseFrontMatter takes the raw meta data, such as from goldmark-meta, and decodes it into the FrontMatter
+func ParseFrontMatter(raw map[string]interface{}) (FrontMatter, error) {
+	frontMatter := FrontMatter{
+		TOC:      true,
+		D2Source: true,
+		Tags:     []string{},
+		Keywords: []string{},
+		Authors:  []string{},
+		Aliases:  []string{},
+		Params:   map[string]interface{}{},
+	}
+	// the keys are sorted so the same error is always reported first
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var err error
+	for _, key := range keys {
+		value := raw[key]
+		switch key {
+		case "title":
+			frontMatter.Title, err = frontMatterString(key, value)
+		case "summary":
+			frontMatter.Summary, err = frontMatterString(key, value)
+		case "description":
+			frontMatter.Description, err = frontMatterString(key, value)
+		case "layout":
+			frontMatter.Layout, err = frontMatterString(key, value)
+		case "tags":
+			frontMatter.Tags, err = frontMatterStrings(key, value)
+		case "keywords":
+			frontMatter.Keywords, err = frontMatterStrings(key, value)
+		case "authors":
+			frontMatter.Authors, err = frontMatterStrings(key, value)
+		case "aliases":
+			frontMatter.Aliases, err = frontMatterStrings(key, value)
+		case "date":
+			frontMatter.Date, err = frontMatterTime(key, value)
+		case "updated":
+			frontMatter.Updated, err = frontMatterTime(key, value)
+		case "publish_date":
+			frontMatter.PublishDate, err = frontMatterTime(key, value)
+		case "draft":
+			frontMatter.Draft, err = frontMatterBool(key, value)
+		case "toc":
+			frontMatter.TOC, err = frontMatterBool(key, value)
+		case "weight":
+			frontMatter.Weight, err = frontMatterInt(key, value)
+		case "d2_theme":
+			frontMatter.D2Theme, err = frontMatterD2Theme(key, value)
+		case "d2_layout":
+			frontMatter.D2Layout, err = frontMatterD2Layout(key, value)
+		case "d2_source":
+			frontMatter.D2Source, err = frontMatterBool(key, value)
+		case "params":
+			params, ok := normalizeFrontMatterValue(value).(map[string]interface{})
+			if !ok && value != nil {
+				err = &FrontMatterError{Key: key, Message: fmt.Sprintf("expected a map but found %T", value)}
+			}
+			for k, v := range params {
+				frontMatter.Params[k] = v
+			}
+		default:
+			// keys set in params win over the top level
+			if _, found := frontMatter.Params[key]; !found {
+				frontMatter.Params[key] = normalizeFrontMatterValue(value)
+			}
+		}
+		if err != nil {
+			return frontMatter, err
+		}
+	}
+	return frontMatter, nil
+}
+
+// splitFrontMatter finds TOML front matter between +++ lines or a JSON object at the top of the content,
+// and returns it decoded along with the content after it. YAML front matter between --- lines is
+// left in the content for goldmark-meta, so found is false for it and for content without any.
+func splitFrontMatter(content []byte) (raw map[string]interface{}, rest []byte, found bool, err error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	raw = map[string]interface{}{}
+	switch {
+	case bytes.HasPrefix(content, []byte("+++\n")) || bytes.HasPrefix(content, []byte("+++\r\n")):
+		lines := bytes.SplitAfter(content, []byte("\n"))
+		for i := 1; i < len(lines); i++ {
+			if string(bytes.TrimRight(lines[i], " \t\r\n")) != "+++" {
+				continue
+			}
+			_, err = toml.Decode(string(bytes.Join(lines[1:i], nil)), &raw)
+			if err != nil {
+				return nil, content, true, fmt.Errorf("front matter: %v", err)
+			}
+			return raw, bytes.Join(lines[i+1:], nil), true, nil
+		}
+		return nil, content, true, fmt.Errorf("front matter: the +++ block is not closed")
+	case jsonFrontMatterRegex.Match(content):
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		err = decoder.Decode(&raw)
+		if err != nil {
+			return nil, content, true, fmt.Errorf("front matter: %v", err)
+		}
+		rest = content[decoder.InputOffset():]
+		// the rest of the line with the closing brace is dropped along with the object
+		if newline := bytes.IndexByte(rest, '\n'); newline != -1 && len(bytes.TrimSpace(rest[:newline])) == 0 {
+			rest = rest[newline+1:]
+		}
+		return raw, rest, true, nil
+	}
+	return nil, content, false, nil
+}
+
+func frontMatterString(key string, value interface{}) (string, error) {
+	switch converted := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return converted, nil
+	case int, int64, float64, bool:
+		return fmt.Sprintf("%v", converted), nil
+	}
+	return "", &FrontMatterError{Key: key, Message: fmt.Sprintf("expected a string but found %T", value)}
+}
+
+func frontMatterStrings(key string, value interface{}) ([]string, error) {
+	switch converted := value.(type) {
+	case nil:
+		return []string{}, nil
+	case string:
+		if strings.TrimSpace(converted) == "" {
+			return []string{}, nil
+		}
+		return []string{converted}, nil
+	case []interface{}:
+		found := []string{}
+		for i := range converted {
+			item, err := frontMatterString(fmt.Sprintf("%s[%d]", key, i), converted[i])
+			if err != nil {
+				return found, err
+			}
+			found = append(found, item)
+		}
+		return found, nil
+	}
+	return []string{}, &FrontMatterError{Key: key, Message: fmt.Sprintf("expected a list of strings but found %T", value)}
+}
+
+func frontMatterTime(key string, value interface{}) (time.Time, error) {
+	switch converted := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return converted, nil
+	case string:
+		for _, layout := range frontMatterDateLayouts {
+			found, err := time.Parse(layout, strings.TrimSpace(converted))
+			if err == nil {
+				return found, nil
+			}
+		}
+		return time.Time{}, &FrontMatterError{Key: key, Message: fmt.Sprintf("could not parse '%s' as a date", converted)}
+	}
+	return time.Time{}, &FrontMatterError{Key: key, Message: fmt.Sprintf("expected a date but found %T", value)}
+}
+
+func frontMatterBool(key string, value interface{}) (bool, error) {
+	switch converted := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return converted, nil
+	}
+	return false, &FrontMatterError{Key: key, Message: fmt.Sprintf("expected true or false but found %T", value)}
+}
+
+func frontMatterInt(key string, value interface{}) (int, error) {
+	switch converted := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return converted, nil
+	case int64:
+		return int(converted), nil
+	case float64:
+		if converted == float64(int(converted)) {
+			return int(converted), nil
+		}
+	}
+	return 0, &FrontMatterError{Key: key, Message: fmt.Sprintf("expected an integer but found %T", value)}
+}
+
+// frontMatterD2Theme converts a D2 theme, given by either its ID or its name, to its ID
+func frontMatterD2Theme(key string, value interface{}) (*int64, error) {
+	name, ok := value.(string)
+	if !ok {
+		id, err := frontMatterInt(key, value)
+		if err != nil {
+			return nil, err
+		}
+		name = strconv.Itoa(id)
+	}
+	theme, err := D2ThemeID(name)
+	if err != nil {
+		return nil, &FrontMatterError{Key: key, Message: err.Error()}
+	}
+	return &theme, nil
+}
+
+// frontMatterD2Layout checks that the D2 layout engine is known
+func frontMatterD2Layout(key string, value interface{}) (string, error) {
+	name, err := frontMatterString(key, value)
+	if err != nil {
+		return "", err
+	}
+	layout, err := D2LayoutName(name)
+	if err != nil {
+		return "", &FrontMatterError{Key: key, Message: err.Error()}
+	}
+	return layout, nil
+}
+
+// normalizeFrontMatterValue converts the nested maps from the YAML and TOML parsers into
+// string keyed maps so they can be used in templates and encoded as JSON
+func normalizeFrontMatterValue(value interface{}) interface{} {
+	switch converted := value.(type) {
+	case map[interface{}]interface{}:
+		found := map[string]interface{}{}
+		for k, v := range converted {
+			found[fmt.Sprintf("%v", k)] = normalizeFrontMatterValue(v)
+		}
+		return found
+	case map[string]interface{}:
+		found := map[string]interface{}{}
+		for k, v := range converted {
+			found[k] = normalizeFrontMatterValue(v)
+		}
+		return found
+	case []interface{}:
+		found := make([]interface{}, len(converted))
+		for i := range converted {
+			found[i] = normalizeFrontMatterValue(converted[i])
+		}
+		return found
+	case []map[string]interface{}:
+		// TOML decodes arrays of tables as a slice of maps
+		found := make([]interface{}, len(converted))
+		for i := range converted {
+			found[i] = normalizeFrontMatterValue(converted[i])
+		}
+		return found
+	}
+	return value
+}
@@ -0,0 +1,183 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		Input         string
+		ExpectedError string
+		Check         func(parse.FrontMatter) string
+	}{
+		{
+			Input: "---\ntitle: Full\nsummary: The summary\ndescription: The description\ntags: single\nkeywords:\n  - one\n  - two\nauthors: Someone\ndate: 2023-01-02\nupdated: 2023-02-03T04:05:06Z\ndraft: true\nweight: 5\naliases:\n  - /old.html\nlayout: wide\nowner: platform\nparams:\n  team:\n    name: Infra\n---\n# Full\n",
+			Check: func(fm parse.FrontMatter) string {
+				if fm.Title != "Full" || fm.Summary != "The summary" || fm.Description != "The description" || fm.Layout != "wide" {
+					return "expected the string keys to be set"
+				}
+				if len(fm.Tags) != 1 || fm.Tags[0] != "single" {
+					return "expected a single string tag to become a list"
+				}
+				if len(fm.Keywords) != 2 || len(fm.Authors) != 1 || len(fm.Aliases) != 1 {
+					return "expected the list keys to be set"
+				}
+				if !fm.Date.Equal(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)) {
+					return "expected the date to be parsed"
+				}
+				if !fm.Updated.Equal(time.Date(2023, 2, 3, 4, 5, 6, 0, time.UTC)) {
+					return "expected the updated date to be parsed"
+				}
+				if !fm.Draft || fm.Weight != 5 {
+					return "expected draft and weight to be set"
+				}
+				if fm.Params["owner"] != "platform" {
+					return "expected unknown keys to be kept in the params"
+				}
+				team, ok := fm.Params["team"].(map[string]interface{})
+				if !ok || team["name"] != "Infra" {
+					return "expected the params to be decoded into string keyed maps"
+				}
+				return ""
+			},
+		},
+		{
+			Input:         "---\ntitle: Bad\nweight: heavy\n---\n# Bad\n",
+			ExpectedError: "front matter key 'weight'",
+		},
+		{
+			Input:         "---\ndraft: yes please\n---\n# Bad\n",
+			ExpectedError: "front matter key 'draft'",
+		},
+		{
+			Input:         "---\ndate: last week\n---\n# Bad\n",
+			ExpectedError: "front matter key 'date'",
+		},
+		{
+			Input:         "---\ntags:\n  - one\n  - nested: map\n---\n# Bad\n",
+			ExpectedError: "front matter key 'tags[1]'",
+		},
+		{
+			Input:         "---\nparams: nope\n---\n# Bad\n",
+			ExpectedError: "front matter key 'params'",
+		},
+		{
+			Input: "---\nd2_theme: Grape Soda\nd2_layout: elk\n---\n# Theme\n",
+			Check: func(fm parse.FrontMatter) string {
+				if fm.D2Theme == nil || *fm.D2Theme != 6 || fm.D2Layout != "elk" {
+					return "expected the theme name to become its ID"
+				}
+				return ""
+			},
+		},
+		{
+			Input: "---\nd2_theme: 0\n---\n# Theme\n",
+			Check: func(fm parse.FrontMatter) string {
+				if fm.D2Theme == nil || *fm.D2Theme != 0 {
+					return "expected the neutral default theme to be set rather than left out"
+				}
+				return ""
+			},
+		},
+		{
+			Input:         "---\nd2_theme: 2\n---\n# Theme\n",
+			ExpectedError: "front matter key 'd2_theme'",
+		},
+		{
+			Input: "---\nd2_source: false\n---\n# Source\n",
+			Check: func(fm parse.FrontMatter) string {
+				if fm.D2Source {
+					return "expected the source to be hidden"
+				}
+				return ""
+			},
+		},
+		{
+			Input:         "---\nd2_source: maybe\n---\n# Bad\n",
+			ExpectedError: "front matter key 'd2_source'",
+		},
+		{
+			Input:         "---\nd2_theme: Not A Theme\n---\n# Bad\n",
+			ExpectedError: "front matter key 'd2_theme'",
+		},
+		{
+			Input:         "---\nd2_layout: elkk\n---\n# Bad\n",
+			ExpectedError: "front matter key 'd2_layout'",
+		},
+		{
+			Input: "+++\ntitle = \"TOML\"\ntags = [\"one\", \"two\"]\ndate = 2023-01-02\nweight = 3\n\n[[params.environments]]\nname = \"prod\"\n+++\nBody\n",
+			Check: func(fm parse.FrontMatter) string {
+				if fm.Title != "TOML" || len(fm.Tags) != 2 || fm.Weight != 3 {
+					return "expected the TOML keys to be set"
+				}
+				if fm.Date.Year() != 2023 || fm.Date.Month() != time.January || fm.Date.Day() != 2 {
+					return "expected the TOML date to be parsed"
+				}
+				environments, ok := fm.Params["environments"].([]interface{})
+				if !ok || len(environments) != 1 || environments[0].(map[string]interface{})["name"] != "prod" {
+					return "expected the array of tables to be decoded into a list of maps"
+				}
+				return ""
+			},
+		},
+		{
+			Input: "{\n  \"title\": \"JSON\",\n  \"tags\": [\"one\"],\n  \"weight\": 2,\n  \"owner\": {\"team\": \"payments\"}\n}\nBody\n",
+			Check: func(fm parse.FrontMatter) string {
+				if fm.Title != "JSON" || len(fm.Tags) != 1 || fm.Weight != 2 {
+					return "expected the JSON keys to be set"
+				}
+				owner, ok := fm.Params["owner"].(map[string]interface{})
+				if !ok || owner["team"] != "payments" {
+					return "expected the nested JSON to be kept in the params"
+				}
+				return ""
+			},
+		},
+		{
+			Input: "{{flow}}\n\n# Flow\n",
+			Check: func(fm parse.FrontMatter) string {
+				if fm.Title != "Flow" {
+					return "expected a diagram at the top of the page to not be front matter"
+				}
+				return ""
+			},
+		},
+		{
+			Input:         "+++\ntitle = \"Unclosed\"\n# Bad\n",
+			ExpectedError: "front matter: the +++ block is not closed",
+		},
+		{
+			Input:         "+++\ntitle = Bad\n+++\n# Bad\n",
+			ExpectedError: "front matter:",
+		},
+		{
+			Input:         "{\"title\": \"Bad\",}\n# Bad\n",
+			ExpectedError: "front matter:",
+		},
+		{
+			Input:         "{\"weight\": 2.5}\n# Bad\n",
+			ExpectedError: "front matter key 'weight'",
+		},
+	}
+
+	for i, tt := range tests {
+		output, err := parse.ParseMD([]byte(tt.Input), "/", nil)
+		if tt.ExpectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.ExpectedError) {
+				t.Errorf("index %d: expected error containing '%s' but found %v", i, tt.ExpectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("index %d: unexpected error: %v", i, err)
+			continue
+		}
+		if message := tt.Check(output.FrontMatter); message != "" {
+			t.Errorf("index %d: %s", i, message)
+		}
+	}
+}
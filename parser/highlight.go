@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// DefaultCodeStyle is the chroma style used when one isn't provided
+const DefaultCodeStyle = "github"
+
+// codeInfoRegex splits a fenced code block's info string, such as `go {3-5,8}`, into the
+// language and the lines to highlight
+var codeInfoRegex = regexp.MustCompile(`^\s*([^\s{]*)\s*(?:\{([\d\s,-]*)\})?`)
+
+// cssRuleRegex finds each rule written by chroma, which starts with a comment naming the token
+var cssRuleRegex = regexp.MustCompile(`(?m)^(/\*[^*]*\*/ )(\S)`)
+
+// codeRenderer renders fenced code blocks with chroma for syntax highlighting
+type codeRenderer struct {
+	style       *chroma.Style
+	lineNumbers bool
+	classes     bool
+}
+
+func newCodeRenderer(options *MarkdownOptions) *codeRenderer {
+	return &codeRenderer{
+		style:       findCodeStyle(options.CodeStyle),
+		lineNumbers: options.CodeLineNumbers,
+		classes:     options.CodeClasses,
+	}
+}
+
+// RegisterFuncs implements the goldmark NodeRenderer
+func (r *codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *codeRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	info := ""
+	if n.Info != nil {
+		info = string(n.Info.Segment.Value(source))
+	}
+	var code bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+	language, ranges := parseCodeInfo(info)
+	_, _ = w.WriteString(r.highlight(code.String(), language, ranges))
+	_ = w.WriteByte('\n')
+	return ast.WalkSkipChildren, nil
+}
+
+// highlight renders the code with chroma; if the language isn't known it falls back to a
+// plain block the same as goldmark would render
+func (r *codeRenderer) highlight(code, language string, ranges [][2]int) string {
+	lexer := lexers.Get(language)
+	if language == "" || lexer == nil {
+		class := ""
+		if language != "" {
+			class = fmt.Sprintf(` class="language-%s"`, util.EscapeHTML([]byte(language)))
+		}
+		return fmt.Sprintf("<pre><code%s>%s</code></pre>", class, util.EscapeHTML([]byte(code)))
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return fmt.Sprintf("<pre><code>%s</code></pre>", util.EscapeHTML([]byte(code)))
+	}
+	formatter := chromahtml.New(
+		chromahtml.WithClasses(r.classes),
+		chromahtml.WithLineNumbers(r.lineNumbers),
+		chromahtml.HighlightLines(ranges),
+	)
+	var buf bytes.Buffer
+	err = formatter.Format(&buf, r.style, iterator)
+	if err != nil {
+		return fmt.Sprintf("<pre><code>%s</code></pre>", util.EscapeHTML([]byte(code)))
+	}
+	return buf.String()
+}
+
+// HighlightCode highlights code outside of the Markdown, such as the source of a diagram, the same
+// as a fenced code block in that language would be
+func HighlightCode(code, language string, options *MarkdownOptions) string {
+	if options == nil {
+		options = &MarkdownOptions{}
+	}
+	return newCodeRenderer(options).highlight(code, language, [][2]int{})
+}
+
+// parseCodeInfo gets the language and the line ranges to highlight from the info string
+func parseCodeInfo(info string) (string, [][2]int) {
+	ranges := [][2]int{}
+	found := codeInfoRegex.FindStringSubmatch(info)
+	if len(found) == 0 {
+		return "", ranges
+	}
+	for _, part := range strings.Split(found[2], ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		start, end, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(start))
+		if err != nil {
+			continue
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(strings.TrimSpace(end))
+			if err != nil || last < first {
+				continue
+			}
+		}
+		ranges = append(ranges, [2]int{first, last})
+	}
+	return found[1], ranges
+}
+
+// findCodeStyle finds the chroma style, falling back to the default if it isn't known
+func findCodeStyle(name string) *chroma.Style {
+	if name == "" {
+		name = DefaultCodeStyle
+	}
+	style, found := styles.Registry[strings.ToLower(name)]
+	if !found {
+		return styles.Get(DefaultCodeStyle)
+	}
+	return style
+}
+
+// IsCodeStyle checks if the name is a known chroma style
+func IsCodeStyle(name string) bool {
+	_, found := styles.Registry[strings.ToLower(name)]
+	return found
+}
+
+// CodeStyleCSS generates the stylesheet for code highlighted with classes. If a dark style is provided,
+// its rules are added under [data-bs-theme="dark"] so the page theme can switch between them
+func CodeStyleCSS(lightStyle, darkStyle string, lineNumbers bool) ([]byte, error) {
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.WithLineNumbers(lineNumbers))
+	var buf bytes.Buffer
+	err := formatter.WriteCSS(&buf, findCodeStyle(lightStyle))
+	if err != nil {
+		return nil, err
+	}
+	if darkStyle == "" {
+		return buf.Bytes(), nil
+	}
+	var dark bytes.Buffer
+	err = formatter.WriteCSS(&dark, findCodeStyle(darkStyle))
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	buf.Write(cssRuleRegex.ReplaceAll(dark.Bytes(), []byte(`$1[data-bs-theme="dark"] $2`)))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,118 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestHighlightCode(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Options     *parse.MarkdownOptions
+		Contains    []string
+		NotContains []string
+	}{
+		{
+			Input:       "```\nplain \"<b>\"\n```\n",
+			Contains:    []string{"<pre><code>plain &quot;&lt;b&gt;&quot;\n</code></pre>\n"},
+			NotContains: []string{"chroma"},
+		},
+		{
+			Input:    "```unknown-language\nx\n```\n",
+			Contains: []string{`<pre><code class="language-unknown-language">x`},
+		},
+		{
+			Input:       "```go\npackage main\n```\n",
+			Contains:    []string{`<pre tabindex="0" style="background-color:`, `style="color:`},
+			NotContains: []string{`class="kn"`},
+		},
+		{
+			Input:       "```go\npackage main\n```\n",
+			Options:     &parse.MarkdownOptions{CodeClasses: true},
+			Contains:    []string{`class="chroma"`, `<span class="kn">package</span>`},
+			NotContains: []string{`style="color:`},
+		},
+		{
+			Input:    "```yaml {2-3}\na: 1\nb: 2\nc: 3\nd: 4\n```\n",
+			Options:  &parse.MarkdownOptions{CodeClasses: true, CodeLineNumbers: true},
+			Contains: []string{`<span class="ln">1</span>`, `<span class="line hl"><span class="ln">2</span>`, `<span class="line hl"><span class="ln">3</span>`, `<span class="line"><span class="ln">4</span>`},
+		},
+	}
+	for i, tt := range tests {
+		output, err := parse.ParseMD([]byte(tt.Input), "/", tt.Options)
+		if err != nil {
+			t.Errorf("index %d: unexpected error: %v", i, err)
+			continue
+		}
+		for _, expected := range tt.Contains {
+			if !strings.Contains(string(output.Content), expected) {
+				t.Errorf("index %d: expected output to contain %s but found %s", i, expected, output.Content)
+			}
+		}
+		for _, unexpected := range tt.NotContains {
+			if strings.Contains(string(output.Content), unexpected) {
+				t.Errorf("index %d: expected output to not contain %s but found %s", i, unexpected, output.Content)
+			}
+		}
+	}
+}
+
+func TestHighlightD2(t *testing.T) {
+	source := "# the login flow\nuser -> api: \"signs in\"\napi: {\n  shape: cylinder\n  style.stroke-dash: 3\n}\n"
+	output := parse.HighlightCode(source, "d2", &parse.MarkdownOptions{CodeClasses: true})
+	for _, expected := range []string{
+		`<span class="c"># the login flow</span>`,
+		`<span class="n">user</span>`,
+		`<span class="o">-&gt;</span>`,
+		`<span class="s2">&#34;signs in&#34;</span>`,
+		`<span class="k">shape</span>`,
+		`<span class="k">stroke-dash</span>`,
+		`<span class="m">3</span>`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected the D2 to contain %s but found %s", expected, output)
+		}
+	}
+	if strings.Contains(output, `class="err"`) {
+		t.Errorf("expected all of the D2 to be understood: %s", output)
+	}
+
+	// the fenced code blocks use the same lexer
+	page, err := parse.ParseMD([]byte("```d2\na -> b\n```\n"), "/", &parse.MarkdownOptions{CodeClasses: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(page.Content), `<span class="o">-&gt;</span>`) {
+		t.Errorf("expected the code block to be highlighted as D2: %s", page.Content)
+	}
+
+	// a language chroma doesn't know is escaped as is
+	if output := parse.HighlightCode("<svg>", "", nil); output != "<pre><code>&lt;svg&gt;</code></pre>" {
+		t.Errorf("expected the plain code to be escaped but found %s", output)
+	}
+}
+
+func TestCodeStyleCSS(t *testing.T) {
+	light, err := parse.CodeStyleCSS("github", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(light), ".chroma .kn {") || strings.Contains(string(light), "data-bs-theme") {
+		t.Errorf("expected only the light rules: %s", light)
+	}
+	both, err := parse.CodeStyleCSS("github", "monokai", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(both), string(light)) {
+		t.Errorf("expected the light rules to come first")
+	}
+	if !strings.Contains(string(both), `[data-bs-theme="dark"] .chroma .kn {`) {
+		t.Errorf("expected the dark rules to be scoped to the dark theme: %s", both)
+	}
+	if !parse.IsCodeStyle("monokai") || parse.IsCodeStyle("not-a-style") {
+		t.Errorf("expected the styles to be checked against chroma")
+	}
+}
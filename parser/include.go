@@ -0,0 +1,409 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/lexers"
+)
+
+// includeRegex finds an include on its own line, such as {{include shared/context.md#Overview}} or
+// {{include src/main.go lines=10-20}}, with the path and any key=value arguments
+var includeRegex = regexp.MustCompile(`^\s*{{include\s+([^\s}]+)((?:\s+\w+=[^\s}]+)*)\s*}}\s*$`)
+
+// fenceRegex finds the start of a fenced code block, so includes inside of code are left alone
+var fenceRegex = regexp.MustCompile("^\\s*(```+|~~~+)")
+
+// includedLinkRegex finds the destinations of inline links and images, such as [text](other.md), and of
+// link reference definitions, such as [id]: other.md, so those in an included file can be made absolute
+var includedLinkRegex = regexp.MustCompile(`(\]\(\s*<?|^ {0,3}\[[^\]]+\]:\s*<?)([^\s)>]+)`)
+
+// atxHeadingRegex finds a Markdown heading and its level when extracting a section
+var atxHeadingRegex = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+
+// regionStartRegex and regionEndRegex find the markers around a named region of a source file, which
+// can be in any comment syntax, such as `// #region setup` and `// #endregion`
+var regionStartRegex = regexp.MustCompile(`#region\s+(\S+)`)
+var regionEndRegex = regexp.MustCompile(`#endregion\b`)
+
+// includer expands the includes for a single page, keeping track of the files being
+// included so cycles can be found
+type includer struct {
+	root      string
+	directory string // the directory of the page, which relative links and embeds are resolved from
+	stack     []string
+	includes  []string
+}
+
+// expandIncludes replaces each include in the Markdown with the contents of the file it points to.
+// Paths are relative to the directory of the page, or to the root if they start with a /, and may
+// not point outside of the root. Relative links and diagram embeds in a file included from another
+// directory are made absolute, so they point where they did from that file. It returns the expanded
+// content and every file that was included, relative to the root.
+func expandIncludes(content []byte, prefix string, root string) ([]byte, []string, error) {
+	resolvedRoot, err := filepath.Abs(root)
+	if err == nil {
+		resolvedRoot, err = filepath.EvalSymlinks(resolvedRoot)
+	}
+	if err != nil {
+		return content, nil, fmt.Errorf("include root %s: %v", root, err)
+	}
+	inc := &includer{
+		root:      resolvedRoot,
+		directory: filepath.Join(resolvedRoot, filepath.FromSlash(filepathToSlash(prefix))),
+		stack:     []string{},
+		includes:  []string{},
+	}
+	expanded, err := inc.expand(string(content), inc.directory)
+	if err != nil {
+		return content, nil, err
+	}
+	return []byte(expanded), inc.includes, nil
+}
+
+// expand replaces the includes in the content, which belongs to a file in the directory
+func (inc *includer) expand(content string, directory string) (string, error) {
+	lines := strings.Split(content, "\n")
+	output := make([]string, 0, len(lines))
+	fence := ""
+	for _, line := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			output = append(output, line)
+			continue
+		}
+		if found := fenceRegex.FindStringSubmatch(line); len(found) > 0 {
+			fence = found[1]
+			output = append(output, line)
+			continue
+		}
+		found := includeRegex.FindStringSubmatch(line)
+		if len(found) == 0 {
+			if directory != inc.directory {
+				line = inc.rebase(line, directory)
+			}
+			output = append(output, line)
+			continue
+		}
+		included, err := inc.include(found[1], strings.Fields(found[2]), directory)
+		if err != nil {
+			return "", fmt.Errorf("include %s: %v", found[1], err)
+		}
+		output = append(output, included)
+	}
+	return strings.Join(output, "\n"), nil
+}
+
+// include reads a single file. Markdown is transcluded, optionally just the section under a
+// heading; anything else, or Markdown with lines or a region, becomes a highlighted code block.
+func (inc *includer) include(target string, args []string, directory string) (string, error) {
+	arguments := map[string]string{}
+	for _, arg := range args {
+		key, value, _ := strings.Cut(arg, "=")
+		switch key {
+		case "lines", "region", "lang":
+			arguments[key] = value
+		default:
+			return "", fmt.Errorf("argument '%s' is not supported, use lines, region, or lang", key)
+		}
+	}
+	name, anchor, _ := strings.Cut(target, "#")
+	file, err := inc.resolve(name, directory)
+	if err != nil {
+		return "", err
+	}
+	for i, parent := range inc.stack {
+		if parent == file {
+			cycle := append(append([]string{}, inc.stack[i:]...), file)
+			for j := range cycle {
+				cycle[j] = inc.relative(cycle[j])
+			}
+			return "", fmt.Errorf("include cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	inc.addInclude(file)
+	text := strings.ReplaceAll(string(contents), "\r\n", "\n")
+
+	_, isExcerpt := arguments["lines"]
+	if _, isRegion := arguments["region"]; isRegion {
+		isExcerpt = true
+	}
+	extension := strings.ToLower(filepath.Ext(file))
+	if (extension == ".md" || extension == ".markdown") && !isExcerpt && arguments["lang"] == "" {
+		text = stripFrontMatter(text)
+		if anchor != "" {
+			text, err = extractSection(text, anchor)
+			if err != nil {
+				return "", err
+			}
+		}
+		inc.stack = append(inc.stack, file)
+		defer func() {
+			inc.stack = inc.stack[:len(inc.stack)-1]
+		}()
+		return inc.expand(strings.TrimRight(text, "\n"), filepath.Dir(file))
+	}
+
+	if value, found := arguments["lines"]; found {
+		text, err = extractLines(text, value)
+		if err != nil {
+			return "", err
+		}
+	}
+	if value, found := arguments["region"]; found {
+		text, err = extractRegion(text, value)
+		if err != nil {
+			return "", err
+		}
+	}
+	language := arguments["lang"]
+	if language == "" {
+		if lexer := lexers.Match(filepath.Base(file)); lexer != nil && len(lexer.Config().Aliases) > 0 {
+			language = lexer.Config().Aliases[0]
+		}
+	}
+	return codeFence(dedent(text), language), nil
+}
+
+// rebase makes the relative links and diagram embeds on a line of an included file absolute, from the
+// file's directory, since the page including it may be somewhere else
+func (inc *includer) rebase(line string, directory string) string {
+	base := inc.relative(directory)
+	line = includedLinkRegex.ReplaceAllStringFunc(line, func(link string) string {
+		parts := includedLinkRegex.FindStringSubmatch(link)
+		value := parts[2]
+		end := strings.IndexAny(value, "?#")
+		if end == -1 {
+			end = len(value)
+		}
+		// anything with a scheme, such as https: or mailto:, is already absolute
+		if end == 0 || strings.HasPrefix(value, "/") || strings.Contains(value[:end], ":") {
+			return link
+		}
+		return parts[1] + path.Join(base, value[:end]) + value[end:]
+	})
+	return imageReplaceRegex.ReplaceAllStringFunc(line, func(embed string) string {
+		parts := imageReplaceRegex.FindStringSubmatch(embed)
+		if strings.HasPrefix(parts[1], "/") {
+			return embed
+		}
+		return fmt.Sprintf("{{%s%s}}", path.Join(base, parts[1]), parts[2])
+	})
+}
+
+// resolve finds the file on disk and makes sure it is inside of the root
+func (inc *includer) resolve(name string, directory string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("a path is required")
+	}
+	file := filepath.Join(directory, filepath.FromSlash(name))
+	if strings.HasPrefix(name, "/") {
+		file = filepath.Join(inc.root, filepath.FromSlash(name))
+	}
+	// the path is checked before and after following any links, so neither can escape the root
+	if !inc.contains(file) {
+		return "", fmt.Errorf("%s is outside of the input directory", name)
+	}
+	resolved, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", fmt.Errorf("could not find %s", name)
+	}
+	if !inc.contains(resolved) {
+		return "", fmt.Errorf("%s is outside of the input directory", name)
+	}
+	return resolved, nil
+}
+
+// contains checks if the file is inside of the root
+func (inc *includer) contains(file string) bool {
+	relative, err := filepath.Rel(inc.root, file)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// relative gets the site path for a file, such as /shared/context.md
+func (inc *includer) relative(file string) string {
+	relative, err := filepath.Rel(inc.root, file)
+	if err != nil {
+		return file
+	}
+	return "/" + filepath.ToSlash(relative)
+}
+
+// addInclude records the file as a dependency of the page
+func (inc *includer) addInclude(file string) {
+	relative := inc.relative(file)
+	for _, existing := range inc.includes {
+		if existing == relative {
+			return
+		}
+	}
+	inc.includes = append(inc.includes, relative)
+}
+
+// stripFrontMatter removes the front matter from an included Markdown file, since only the page's own is used
+func stripFrontMatter(text string) string {
+	if _, rest, found, err := splitFrontMatter([]byte(text)); found && err == nil {
+		return strings.TrimLeft(string(rest), "\n")
+	}
+	if !strings.HasPrefix(text, "---\n") {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], " \t") == "---" {
+			return strings.TrimLeft(strings.Join(lines[i+1:], "\n"), "\n")
+		}
+	}
+	return text
+}
+
+// extractSection finds the heading matching the anchor, by text or ID, and returns it with everything
+// below it up to the next heading of the same or a higher level
+func extractSection(text string, anchor string) (string, error) {
+	lines := strings.Split(text, "\n")
+	start, level := -1, 0
+	fence := ""
+	for i, line := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if found := fenceRegex.FindStringSubmatch(line); len(found) > 0 {
+			fence = found[1]
+			continue
+		}
+		found := atxHeadingRegex.FindStringSubmatch(line)
+		if len(found) == 0 {
+			continue
+		}
+		if start != -1 {
+			if len(found[1]) <= level {
+				return strings.Join(lines[start:i], "\n"), nil
+			}
+			continue
+		}
+		if found[2] == anchor || Slugify(found[2]) == Slugify(anchor) {
+			start, level = i, len(found[1])
+		}
+	}
+	if start == -1 {
+		return "", fmt.Errorf("could not find the heading '%s'", anchor)
+	}
+	return strings.Join(lines[start:], "\n"), nil
+}
+
+// extractLines gets the lines, starting at 1, in a range such as 10-20, 10-, or 10
+func extractLines(text string, value string) (string, error) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	start, end, isRange := strings.Cut(value, "-")
+	first, err := strconv.Atoi(start)
+	if err != nil || first < 1 {
+		return "", fmt.Errorf("lines must be in the form 10-20 but was '%s'", value)
+	}
+	last := first
+	if isRange {
+		last = len(lines)
+		if end != "" {
+			last, err = strconv.Atoi(end)
+			if err != nil || last < first {
+				return "", fmt.Errorf("lines must be in the form 10-20 but was '%s'", value)
+			}
+		}
+	}
+	if last > len(lines) {
+		return "", fmt.Errorf("lines %s is past the end of the file, which has %d lines", value, len(lines))
+	}
+	return strings.Join(lines[first-1:last], "\n"), nil
+}
+
+// extractRegion gets the lines between the #region and #endregion markers for the name, leaving out
+// the markers of the region and any regions inside of it
+func extractRegion(text string, name string) (string, error) {
+	output := []string{}
+	depth := 0
+	for _, line := range strings.Split(text, "\n") {
+		start := regionStartRegex.FindStringSubmatch(line)
+		if depth == 0 {
+			if len(start) > 0 && start[1] == name {
+				depth = 1
+			}
+			continue
+		}
+		if len(start) > 0 {
+			depth++
+			continue
+		}
+		if regionEndRegex.MatchString(line) {
+			depth--
+			if depth == 0 {
+				return strings.Join(output, "\n"), nil
+			}
+			continue
+		}
+		output = append(output, line)
+	}
+	if depth == 0 {
+		return "", fmt.Errorf("could not find the region '%s'", name)
+	}
+	return "", fmt.Errorf("the region '%s' does not have an #endregion", name)
+}
+
+// dedent removes the indentation shared by every line, so an excerpt from inside a function isn't pushed over
+func dedent(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	indent := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		current := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent = current
+			first = false
+		}
+		for !strings.HasPrefix(current, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	if indent == "" {
+		return strings.Join(lines, "\n")
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, indent)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// codeFence wraps the code in a fence that is longer than any run of backticks inside of it
+func codeFence(code string, language string) string {
+	longest, current := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			current++
+			if current > longest {
+				longest = current
+			}
+		} else {
+			current = 0
+		}
+	}
+	fence := strings.Repeat("`", 3)
+	if longest >= 3 {
+		fence = strings.Repeat("`", longest+1)
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, language, code, fence)
+}
@@ -0,0 +1,164 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestIncludes(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"shared/_context.md": "---\ntitle: Ignored\n---\n\nThe system talks to [[Billing]].\n\n## Overview\n\nOverview text\n\n### Details\n\nDetail text\n\n## Other\n\nOther text\n",
+		"shared/nested.md":   "Nested start\n\n{{include _context.md#overview}}\n",
+		"shared/a.md":        "{{include b.md}}\n",
+		"shared/b.md":        "{{include a.md}}\n",
+		"src/main.go":        "package main\n\nfunc main() {\n\t// #region setup\n\tconfig := load()\n\t// #endregion\n\trun(config)\n}\n",
+		"src/config.yaml":    "name: sample\nreplicas: 3\n",
+		"flows/_login.md":    "{{login inline}}\n\nSee [the steps](steps.md#two), [the root](/index.md), [the site](https://example.com), and [ref].\n\n[ref]: ../shared/a.md\n\n```md\n[kept](steps.md)\n```\n",
+	}
+	for name, contents := range files {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	options := &parse.MarkdownOptions{IncludeRoot: root}
+
+	tests := []struct {
+		Input            string
+		Prefix           string
+		ExpectedContains []string
+		ExpectedMissing  []string
+		ExpectedIncludes []string
+		ExpectedError    string
+	}{
+		{
+			Input:            "# Page\n\n{{include /shared/_context.md}}\n",
+			Prefix:           "/",
+			ExpectedContains: []string{"Overview text", "Detail text", "Other text", `data-wiki-link="Billing"`},
+			ExpectedMissing:  []string{"Ignored"},
+			ExpectedIncludes: []string{"/shared/_context.md"},
+		},
+		{
+			Input:            "# Page\n\n{{include _context.md#Overview}}\n",
+			Prefix:           "/shared/",
+			ExpectedContains: []string{`<h2 id="overview">`, "Overview text", "Detail text"},
+			ExpectedMissing:  []string{"system talks", "Other text"},
+			ExpectedIncludes: []string{"/shared/_context.md"},
+		},
+		{
+			Input:            "# Page\n\n{{include ../shared/nested.md}}\n",
+			Prefix:           "/docs/",
+			ExpectedContains: []string{"Nested start", "Overview text"},
+			ExpectedIncludes: []string{"/shared/nested.md", "/shared/_context.md"},
+		},
+		{
+			Input:  "# Page\n\n{{include ../flows/_login.md}}\n",
+			Prefix: "/docs/",
+			ExpectedContains: []string{
+				"<img src='/flows/login.svg' class='diagram-svg' alt='diagram' data-embed='inline' />",
+				`<a href="/flows/steps.html#two">`,
+				`<a href="/index.html">`,
+				`<a href="https://example.com">`,
+				`<a href="/shared/a.html">`,
+			},
+			ExpectedMissing:  []string{"/flows/steps.md"},
+			ExpectedIncludes: []string{"/flows/_login.md"},
+		},
+		{
+			Input:            "# Page\n\n{{include _login.md}}\n",
+			Prefix:           "/flows/",
+			ExpectedContains: []string{"<img src='/flows/login.svg'", `<a href="steps.html#two">`},
+			ExpectedIncludes: []string{"/flows/_login.md"},
+		},
+		{
+			Input:            "# Page\n\n{{include /src/main.go region=setup}}\n\n{{include /src/config.yaml lines=2}}\n",
+			Prefix:           "/",
+			ExpectedContains: []string{"config", "load", "replicas"},
+			ExpectedMissing:  []string{"#region", "run", "sample"},
+			ExpectedIncludes: []string{"/src/main.go", "/src/config.yaml"},
+		},
+		{
+			Input:            "# Page\n\n```md\n{{include /missing.md}}\n```\n",
+			Prefix:           "/",
+			ExpectedContains: []string{"{{include /missing.md}}"},
+			ExpectedIncludes: []string{},
+		},
+		{
+			Input:         "# Page\n\n{{include /missing.md}}\n",
+			Prefix:        "/",
+			ExpectedError: "could not find /missing.md",
+		},
+		{
+			Input:         "# Page\n\n{{include ../../etc/passwd}}\n",
+			Prefix:        "/shared/",
+			ExpectedError: "outside of the input directory",
+		},
+		{
+			Input:         "# Page\n\n{{include /shared/a.md}}\n",
+			Prefix:        "/",
+			ExpectedError: "include cycle /shared/a.md -> /shared/b.md -> /shared/a.md",
+		},
+		{
+			Input:         "# Page\n\n{{include /shared/_context.md#Missing}}\n",
+			Prefix:        "/",
+			ExpectedError: "could not find the heading 'Missing'",
+		},
+		{
+			Input:         "# Page\n\n{{include /src/main.go lines=7-20}}\n",
+			Prefix:        "/",
+			ExpectedError: "past the end of the file",
+		},
+		{
+			Input:         "# Page\n\n{{include /src/main.go region=missing}}\n",
+			Prefix:        "/",
+			ExpectedError: "could not find the region 'missing'",
+		},
+		{
+			Input:         "# Page\n\n{{include /src/main.go color=red}}\n",
+			Prefix:        "/",
+			ExpectedError: "argument 'color' is not supported",
+		},
+	}
+
+	for i := range tests {
+		leaf, err := parse.ParseMD([]byte(tests[i].Input), tests[i].Prefix, options)
+		if tests[i].ExpectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), tests[i].ExpectedError) {
+				t.Errorf("test %d: expected an error containing '%s' but found %v", i, tests[i].ExpectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		content := string(leaf.Content)
+		for _, expected := range tests[i].ExpectedContains {
+			if !strings.Contains(content, expected) {
+				t.Errorf("test %d: expected the content to contain %s but found %s", i, expected, content)
+			}
+		}
+		for _, missing := range tests[i].ExpectedMissing {
+			if strings.Contains(content, missing) {
+				t.Errorf("test %d: expected the content to not contain %s but found %s", i, missing, content)
+			}
+		}
+		if strings.Join(leaf.Includes, ",") != strings.Join(tests[i].ExpectedIncludes, ",") {
+			t.Errorf("test %d: expected the includes %v but found %v", i, tests[i].ExpectedIncludes, leaf.Includes)
+		}
+	}
+
+	// without a root, the includes are left alone
+	leaf, err := parse.ParseMD([]byte("# Page\n\n{{include /src/main.go}}\n"), "/", nil)
+	if err != nil || !strings.Contains(string(leaf.Content), "{{include /src/main.go}}") {
+		t.Errorf("expected the include to be left alone without a root: %v %v", err, leaf)
+	}
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindWikiLink is the goldmark node kind for a [[Page]] link
+var KindWikiLink = ast.NewNodeKind("WikiLink")
+
+// WikiLinkRegex finds the wiki links rendered by ParseMD so the caller can resolve them once every page is known
+var WikiLinkRegex = regexp.MustCompile(`<a href="#" class="wiki-link" data-wiki-link="([^"]*)">`)
+
+// referencesContextKey is used to pass the pages linked to back to ParseMD
+var referencesContextKey = parser.NewContextKey()
+
+// WikiLink is a link to another page by its title or path, written as [[Target]] or [[Target|Label]]
+type WikiLink struct {
+	ast.BaseInline
+	Target []byte
+	Label  []byte
+}
+
+// Kind implements the goldmark Node
+func (n *WikiLink) Kind() ast.NodeKind {
+	return KindWikiLink
+}
+
+// Dump implements the goldmark Node
+func (n *WikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Target": string(n.Target),
+		"Label":  string(n.Label),
+	}, nil)
+}
+
+// wikiLinkParser parses the [[Target]] syntax
+type wikiLinkParser struct{}
+
+// Trigger implements the goldmark InlineParser
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+// Parse implements the goldmark InlineParser
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end == -1 {
+		return nil
+	}
+	inner := bytes.TrimSpace(line[2:end])
+	if len(inner) == 0 {
+		return nil
+	}
+	target, label := inner, inner
+	if split := bytes.IndexByte(inner, '|'); split != -1 {
+		target = bytes.TrimSpace(inner[:split])
+		label = bytes.TrimSpace(inner[split+1:])
+	}
+	block.Advance(end + 2)
+	return &WikiLink{
+		Target: target,
+		Label:  label,
+	}
+}
+
+// wikiLinkRenderer renders the wiki links with the target as a data attribute
+type wikiLinkRenderer struct{}
+
+// RegisterFuncs implements the goldmark NodeRenderer
+func (r *wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindWikiLink, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		n := node.(*WikiLink)
+		_, _ = w.WriteString(fmt.Sprintf(`<a href="#" class="wiki-link" data-wiki-link="%s">%s</a>`, util.EscapeHTML(n.Target), util.EscapeHTML(n.Label)))
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// markdownLinkTransformer rewrites relative links to other Markdown files to the generated
+// HTML files and collects them, so the caller can check that they exist
+type markdownLinkTransformer struct {
+	prefix string
+}
+
+// Transform implements the goldmark ASTTransformer
+func (transformer *markdownLinkTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	references := []string{}
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		link, ok := n.(*ast.Link)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		destination, err := url.Parse(string(link.Destination))
+		if err != nil || destination.Scheme != "" || destination.Host != "" || !strings.HasSuffix(destination.Path, ".md") {
+			return ast.WalkContinue, nil
+		}
+		destination.Path = strings.TrimSuffix(destination.Path, ".md") + ".html"
+		link.Destination = []byte(destination.String())
+
+		absolute := destination.Path
+		if !strings.HasPrefix(absolute, "/") {
+			absolute = path.Join("/", filepathToSlash(transformer.prefix), absolute)
+		}
+		if destination.Fragment != "" {
+			absolute += "#" + destination.Fragment
+		}
+		references = append(references, absolute)
+		return ast.WalkContinue, nil
+	})
+	pc.Set(referencesContextKey, references)
+}
+
+// filepathToSlash makes sure the prefix, which comes from the file system, uses forward slashes
+func filepathToSlash(prefix string) string {
+	return strings.ReplaceAll(prefix, "\\", "/")
+}
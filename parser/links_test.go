@@ -0,0 +1,57 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestLinks(t *testing.T) {
+	tests := []struct {
+		Input              string
+		Prefix             string
+		Contains           []string
+		ExpectedReferences []string
+	}{
+		{
+			Input:              "[login](../user_flows/login.md) and [servers](servers.md#overview)",
+			Prefix:             "/docs/",
+			Contains:           []string{`<a href="../user_flows/login.html">login</a>`, `<a href="servers.html#overview">servers</a>`},
+			ExpectedReferences: []string{"/user_flows/login.html", "/docs/servers.html#overview"},
+		},
+		{
+			Input:              "[root](/index.md) [site](https://example.com/readme.md) [file](notes.txt)",
+			Prefix:             "/docs/",
+			Contains:           []string{`<a href="/index.html">root</a>`, `<a href="https://example.com/readme.md">site</a>`, `<a href="notes.txt">file</a>`},
+			ExpectedReferences: []string{"/index.html"},
+		},
+		{
+			Input:              "See [[Login Flow]] or [[user_flows/login#Step Two|the second step]] but not [regular](#here)",
+			Prefix:             "/",
+			Contains:           []string{`<a href="#" class="wiki-link" data-wiki-link="Login Flow">Login Flow</a>`, `<a href="#" class="wiki-link" data-wiki-link="user_flows/login#Step Two">the second step</a>`, `<a href="#here">regular</a>`},
+			ExpectedReferences: []string{},
+		},
+		{
+			Input:              "Not a link [[]] or [single]",
+			Prefix:             "/",
+			Contains:           []string{"[[]]", "[single]"},
+			ExpectedReferences: []string{},
+		},
+	}
+	for i, tt := range tests {
+		output, err := parse.ParseMD([]byte(tt.Input), tt.Prefix, nil)
+		if err != nil {
+			t.Errorf("index %d: unexpected error: %v", i, err)
+			continue
+		}
+		for _, expected := range tt.Contains {
+			if !strings.Contains(string(output.Content), expected) {
+				t.Errorf("index %d: expected output to contain %s but found %s", i, expected, output.Content)
+			}
+		}
+		if strings.Join(output.References, ",") != strings.Join(tt.ExpectedReferences, ",") {
+			t.Errorf("index %d: expected references %v but found %v", i, tt.ExpectedReferences, output.References)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"oss.terrastruct.com/d2/d2renderers/d2latex"
+)
+
+// KindMathInline and KindMathBlock are the goldmark node kinds for math in a paragraph and math on its own
+var KindMathInline = ast.NewNodeKind("MathInline")
+var KindMathBlock = ast.NewNodeKind("MathBlock")
+
+// MathRegex finds the rendered math, with the TeX, so the caller can swap the SVG for text where it isn't wanted, such as search
+var MathRegex = regexp.MustCompile(`(?s)<(?:span|div) class="math math-(?:inline|display)" data-tex="([^"]*)">.*?</svg></(?:span|div)>`)
+
+// mathErrorRegex finds the error MathJax renders into the SVG when the TeX can't be parsed
+var mathErrorRegex = regexp.MustCompile(`data-mjx-error="([^"]*)"`)
+
+// mathCache holds the rendered formulas, since each one starts MathJax from scratch; it is shared
+// by every page so a formula used across the site is only rendered once
+var mathCache = struct {
+	sync.Mutex
+	formulas map[string]string
+}{
+	formulas: map[string]string{},
+}
+
+// MathInline is a formula in a paragraph, written as $x$, or as $$x$$ to display it on its own line
+type MathInline struct {
+	ast.BaseInline
+	Formula []byte
+	Display bool
+}
+
+// Kind implements the goldmark Node
+func (n *MathInline) Kind() ast.NodeKind {
+	return KindMathInline
+}
+
+// Dump implements the goldmark Node
+func (n *MathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Formula": string(n.Formula),
+		"Display": fmt.Sprintf("%t", n.Display),
+	}, nil)
+}
+
+// MathBlock is a displayed formula between lines starting and ending with $$
+type MathBlock struct {
+	ast.BaseBlock
+	Formula []byte
+	closed  bool
+}
+
+// Kind implements the goldmark Node
+func (n *MathBlock) Kind() ast.NodeKind {
+	return KindMathBlock
+}
+
+// Dump implements the goldmark Node
+func (n *MathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Formula": string(n.Formula),
+	}, nil)
+}
+
+// IsRaw implements the goldmark Node, since the formula isn't Markdown
+func (n *MathBlock) IsRaw() bool {
+	return true
+}
+
+// mathBlockParser parses the $$ blocks
+type mathBlockParser struct{}
+
+// Trigger implements the goldmark BlockParser
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Open implements the goldmark BlockParser
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	rest := trimmed[2:]
+	node := &MathBlock{}
+	if end := bytes.Index(rest, []byte("$$")); end != -1 {
+		// $$x$$ followed by more text is math in a paragraph instead
+		if end != len(rest)-2 || end == 0 {
+			return nil, parser.NoChildren
+		}
+		node.Formula = append(node.Formula, rest[:end]...)
+		node.closed = true
+	} else if len(rest) > 0 {
+		node.Formula = append(node.Formula, rest...)
+		node.Formula = append(node.Formula, '\n')
+	}
+	reader.Advance(lineLength(line, segment))
+	return node, parser.NoChildren
+}
+
+// Continue implements the goldmark BlockParser
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*MathBlock)
+	if n.closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		n.Formula = append(n.Formula, trimmed[:len(trimmed)-2]...)
+		n.closed = true
+		reader.Advance(lineLength(line, segment))
+		return parser.Close
+	}
+	n.Formula = append(n.Formula, line...)
+	reader.Advance(lineLength(line, segment))
+	return parser.Continue | parser.NoChildren
+}
+
+// Close implements the goldmark BlockParser
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph implements the goldmark BlockParser
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements the goldmark BlockParser
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// mathInlineParser parses $x$ and $$x$$ in a paragraph. Like pandoc, the opening $ can't be followed
+// by a space and the closing $ can't follow a space or be followed by a digit, so prices such as
+// "$5 and $10" are left alone
+type mathInlineParser struct{}
+
+// Trigger implements the goldmark InlineParser
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse implements the goldmark InlineParser
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if bytes.HasPrefix(line, []byte("$$")) {
+		end := bytes.Index(line[2:], []byte("$$"))
+		if end < 1 {
+			return nil
+		}
+		block.Advance(end + 4)
+		return &MathInline{
+			Formula: append([]byte{}, line[2:end+2]...),
+			Display: true,
+		}
+	}
+	if len(line) < 3 || util.IsSpace(line[1]) || line[1] == '$' {
+		return nil
+	}
+	for i := 2; i < len(line); i++ {
+		if line[i] != '$' || util.IsSpace(line[i-1]) || line[i-1] == '\\' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+			continue
+		}
+		block.Advance(i + 1)
+		return &MathInline{
+			Formula: append([]byte{}, line[1:i]...),
+		}
+	}
+	return nil
+}
+
+// mathRenderer renders the math to SVG with MathJax
+type mathRenderer struct{}
+
+// RegisterFuncs implements the goldmark NodeRenderer
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMathInline, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		n := node.(*MathInline)
+		svg, err := RenderMath(string(n.Formula), n.Display)
+		if err != nil {
+			return ast.WalkStop, err
+		}
+		class := "math math-inline"
+		if n.Display {
+			class = "math math-display"
+		}
+		_, _ = w.WriteString(fmt.Sprintf(`<span class="%s" data-tex="%s">%s</span>`, class, util.EscapeHTML(n.Formula), svg))
+		return ast.WalkSkipChildren, nil
+	})
+	reg.Register(KindMathBlock, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		n := node.(*MathBlock)
+		svg, err := RenderMath(string(n.Formula), true)
+		if err != nil {
+			return ast.WalkStop, err
+		}
+		_, _ = w.WriteString(fmt.Sprintf("<div class=\"math math-display\" data-tex=\"%s\">%s</div>\n", util.EscapeHTML(bytes.TrimSpace(n.Formula)), svg))
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// RenderMath renders the TeX formula to SVG with the MathJax bundled in D2, caching the result.
+// Displayed formulas are rendered with \displaystyle, so fractions and limits are full size.
+func RenderMath(formula string, display bool) (string, error) {
+	formula = strings.TrimSpace(formula)
+	if display {
+		formula = `\displaystyle{` + formula + `}`
+	}
+	mathCache.Lock()
+	defer mathCache.Unlock()
+	if svg, found := mathCache.formulas[formula]; found {
+		return svg, nil
+	}
+	// the formula is placed in a JavaScript template string, so anything special there needs escaping
+	escaped := strings.NewReplacer(`\`, `\\`, "`", "\\`", "${", `\${`).Replace(formula)
+	svg, err := d2latex.Render(escaped)
+	if err != nil {
+		return "", fmt.Errorf("math %s: %v", formula, err)
+	}
+	if found := mathErrorRegex.FindStringSubmatch(svg); len(found) > 0 {
+		return "", fmt.Errorf("math %s: %s", formula, html.UnescapeString(found[1]))
+	}
+	mathCache.formulas[formula] = svg
+	return svg, nil
+}
@@ -0,0 +1,96 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestMath(t *testing.T) {
+	tests := []struct {
+		Input            string
+		Options          *parse.MarkdownOptions
+		ExpectedContains []string
+		ExpectedMissing  []string
+		ExpectAnError    bool
+	}{
+		{
+			Input:            "# Page\n\nThe load is $\\frac{r}{c}$ per node.\n",
+			ExpectedContains: []string{`<p>The load is <span class="math math-inline" data-tex="\frac{r}{c}"><svg `, `</svg></span> per node.</p>`},
+		},
+		{
+			Input:            "# Page\n\n$$\n\\sum_{i=1}^{n} x_i\n$$\n\nAfter\n",
+			ExpectedContains: []string{`<div class="math math-display" data-tex="\sum_{i=1}^{n} x_i"><svg `, "</svg></div>\n<p>After</p>"},
+		},
+		{
+			Input:            "# Page\n\n$$x^2$$\n",
+			ExpectedContains: []string{`<div class="math math-display" data-tex="x^2"><svg `},
+		},
+		{
+			Input:            "# Page\n\nSee $$x^2$$ inline\n",
+			ExpectedContains: []string{`<p>See <span class="math math-display" data-tex="x^2"><svg `},
+		},
+		{
+			Input:            "# Page\n\nIt costs $5 and $10 per month.\n\nThis \\$x$ is escaped, and `$y$` is in code.\n",
+			ExpectedContains: []string{"<p>It costs $5 and $10 per month.</p>", "<p>This $x$ is escaped, and <code>$y$</code> is in code.</p>"},
+			ExpectedMissing:  []string{"<svg"},
+		},
+		{
+			Input:            "# Page\n\nThe load is $x$\n",
+			Options:          &parse.MarkdownOptions{DisableMath: true},
+			ExpectedContains: []string{"<p>The load is $x$</p>"},
+		},
+		{
+			Input:         "# Page\n\n$\\frac{a}{$\n",
+			ExpectAnError: true,
+		},
+	}
+
+	for i := range tests {
+		leaf, err := parse.ParseMD([]byte(tests[i].Input), "/", tests[i].Options)
+		if tests[i].ExpectAnError {
+			if err == nil {
+				t.Errorf("test %d: expected an error but found none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		content := string(leaf.Content)
+		for _, expected := range tests[i].ExpectedContains {
+			if !strings.Contains(content, expected) {
+				t.Errorf("test %d: expected the content to contain %s but found %s", i, expected, content)
+			}
+		}
+		if stripped := parse.MathRegex.ReplaceAllString(content, "$1"); strings.Contains(stripped, "<svg") {
+			t.Errorf("test %d: expected all of the math to be found but found %s", i, stripped)
+		}
+		for _, missing := range tests[i].ExpectedMissing {
+			if strings.Contains(content, missing) {
+				t.Errorf("test %d: expected the content to not contain %s", i, missing)
+			}
+		}
+	}
+}
+
+func TestRenderMath(t *testing.T) {
+	inline, err := parse.RenderMath("a `b` ${c}", false)
+	if err != nil || !strings.HasPrefix(inline, "<svg") {
+		t.Fatalf("expected the special characters to be escaped for MathJax: %v %s", err, inline)
+	}
+	display, err := parse.RenderMath("a `b` ${c}", true)
+	if err != nil || display == inline {
+		t.Errorf("expected displayed math to be rendered differently: %v", err)
+	}
+	cached, _ := parse.RenderMath("a `b` ${c}", false)
+	if cached != inline {
+		t.Errorf("expected the cached formula to be the same")
+	}
+	_, err = parse.RenderMath(`\frac{a}{`, false)
+	if err == nil || !strings.Contains(err.Error(), "Missing close brace") {
+		t.Errorf("expected the MathJax error to be returned but found %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/util"
+)
+
+// shortcodeRegex finds a shortcode tag, such as {{< card "Billing" owner="payments" >}}, {{< /card >}},
+// or the self-closing {{< legend />}}, with the name and the raw arguments
+var shortcodeRegex = regexp.MustCompile(`{{<\s*(/?)([\w-]+)((?:\s+(?:[\w-]+=)?(?:"[^"]*"|[^\s"/>]+))*)\s*(/?)>}}`)
+
+// shortcodeEscapeRegex finds a shortcode written as {{</* name */>}}, which is output as is
+var shortcodeEscapeRegex = regexp.MustCompile(`{{<\s*/\*(.*?)\*/\s*>}}`)
+
+// shortcodeArgRegex splits the raw arguments into the optional name and the value, which may be quoted
+var shortcodeArgRegex = regexp.MustCompile(`(?:([\w-]+)=)?(?:"([^"]*)"|([^\s"/>]+))`)
+
+// ShortcodeData is passed to the shortcode's template when it is executed
+type ShortcodeData struct {
+	Name   string                 // the name of the shortcode
+	Args   []string               // the positional arguments, in order
+	Params map[string]string      // the named arguments
+	Inner  template.HTML          // the Markdown between the opening and closing tags, rendered to HTML
+	Prefix string                 // the directory of the page in the site, such as /user_flows/
+	Data   map[string]interface{} // the site's data files, from MarkdownOptions.Data
+}
+
+// Get returns the named argument, or an empty string if it wasn't provided
+func (data ShortcodeData) Get(name string) string {
+	return data.Params[name]
+}
+
+// Arg returns the positional argument, or an empty string if it wasn't provided
+func (data ShortcodeData) Arg(index int) string {
+	if index < 0 || index >= len(data.Args) {
+		return ""
+	}
+	return data.Args[index]
+}
+
+// ShortcodeFuncs are the functions available to the shortcode templates
+var ShortcodeFuncs = template.FuncMap{
+	// diagram embeds a diagram the same as {{name}} in the Markdown, so it is compiled and indexed
+	"diagram": func(name string) template.HTML {
+		return template.HTML(fmt.Sprintf("{{%s}}", name))
+	},
+}
+
+// LoadShortcodes parses every .html file in the directory as a shortcode named after the file,
+// so shortcodes/callout.html is used as {{< callout >}}. A directory that doesn't exist has no shortcodes.
+func LoadShortcodes(directory string) (map[string]*template.Template, error) {
+	shortcodes := map[string]*template.Template{}
+	entries, err := os.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return shortcodes, nil
+	}
+	if err != nil {
+		return shortcodes, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".html" {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		contents, err := os.ReadFile(filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return shortcodes, err
+		}
+		shortcode, err := template.New(name).Funcs(ShortcodeFuncs).Parse(string(contents))
+		if err != nil {
+			return shortcodes, fmt.Errorf("shortcode %s: %v", name, err)
+		}
+		shortcodes[name] = shortcode
+	}
+	return shortcodes, nil
+}
+
+// shortcodeRenderer replaces the shortcodes in the Markdown with placeholders before it is converted,
+// since goldmark would otherwise escape or drop their HTML, and then swaps the rendered HTML back in
+type shortcodeRenderer struct {
+	markdown   goldmark.Markdown
+	ids        parser.IDs
+	shortcodes map[string]*template.Template
+	prefix     string
+	data       map[string]interface{}
+	rendered   []string
+	escaped    []string
+	references []string
+	headings   []*TOCEntry // the headings in the inner content, in the order they were converted
+	decisions  []Decision  // the decisions in the inner content, in the order they were converted
+}
+
+func newShortcodeRenderer(markdown goldmark.Markdown, ids parser.IDs, shortcodes map[string]*template.Template, prefix string, data map[string]interface{}) *shortcodeRenderer {
+	return &shortcodeRenderer{
+		markdown:   markdown,
+		ids:        ids,
+		shortcodes: shortcodes,
+		prefix:     prefix,
+		data:       data,
+		rendered:   []string{},
+		escaped:    []string{},
+		references: []string{},
+		headings:   []*TOCEntry{},
+		decisions:  []Decision{},
+	}
+}
+
+// placeholder is the text a rendered shortcode is swapped in for
+func (r *shortcodeRenderer) placeholder(index int) string {
+	return fmt.Sprintf("d2tositeshortcode%dx", index)
+}
+
+// process renders the shortcodes in the content and replaces them with placeholders
+func (r *shortcodeRenderer) process(content string) (string, error) {
+	// escaped shortcodes are set aside first so they aren't rendered
+	content = shortcodeEscapeRegex.ReplaceAllStringFunc(content, func(match string) string {
+		return r.escape("{{<" + shortcodeEscapeRegex.FindStringSubmatch(match)[1] + ">}}")
+	})
+	// as are the ones in fenced code blocks, which are examples of the shortcode
+	lines := strings.Split(content, "\n")
+	fence := ""
+	for i, line := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+				continue
+			}
+			lines[i] = shortcodeRegex.ReplaceAllStringFunc(line, r.escape)
+			continue
+		}
+		if found := fenceRegex.FindStringSubmatch(line); len(found) > 0 {
+			fence = found[1]
+		}
+	}
+	content = strings.Join(lines, "\n")
+
+	var output strings.Builder
+	for {
+		location := shortcodeRegex.FindStringSubmatchIndex(content)
+		if location == nil {
+			output.WriteString(content)
+			break
+		}
+		tag := shortcodeRegex.FindStringSubmatch(content[location[0]:location[1]])
+		if tag[1] == "/" {
+			return "", fmt.Errorf("shortcode %s is closed without being opened", tag[2])
+		}
+		output.WriteString(content[:location[0]])
+		content = content[location[1]:]
+
+		inner, hasInner := "", false
+		if tag[4] != "/" {
+			end, next := findShortcodeEnd(content, tag[2])
+			if end != -1 {
+				inner, hasInner = content[:end], true
+				content = content[next:]
+			}
+		}
+		html, err := r.render(tag[2], tag[3], inner, hasInner)
+		if err != nil {
+			return "", err
+		}
+		r.rendered = append(r.rendered, html)
+		output.WriteString(r.placeholder(len(r.rendered) - 1))
+	}
+
+	return output.String(), nil
+}
+
+// escape sets the shortcode aside to be put back as text, returning its placeholder
+func (r *shortcodeRenderer) escape(tag string) string {
+	r.escaped = append(r.escaped, tag)
+	return fmt.Sprintf("d2tositeescaped%dx", len(r.escaped)-1)
+}
+
+// findShortcodeEnd finds the closing tag for the shortcode, allowing for the same shortcode nested
+// inside of it, and returns where the inner content ends and where the content after the tag starts
+func findShortcodeEnd(content string, name string) (int, int) {
+	depth := 1
+	for _, location := range shortcodeRegex.FindAllStringSubmatchIndex(content, -1) {
+		if content[location[4]:location[5]] != name {
+			continue
+		}
+		closing := location[3] > location[2]
+		selfClosing := location[9] > location[8]
+		switch {
+		case closing:
+			depth--
+			if depth == 0 {
+				return location[0], location[1]
+			}
+		case !selfClosing:
+			depth++
+		}
+	}
+	return -1, -1
+}
+
+// render executes the shortcode's template, rendering any inner Markdown first
+func (r *shortcodeRenderer) render(name string, rawArgs string, inner string, hasInner bool) (string, error) {
+	shortcode, found := r.shortcodes[name]
+	if !found {
+		return "", fmt.Errorf("shortcode %s is not defined", name)
+	}
+	data := ShortcodeData{
+		Name:   name,
+		Args:   []string{},
+		Params: map[string]string{},
+		Prefix: r.prefix,
+		Data:   r.data,
+	}
+	for _, arg := range shortcodeArgRegex.FindAllStringSubmatch(rawArgs, -1) {
+		value := arg[2] + arg[3]
+		if arg[1] != "" {
+			data.Params[arg[1]] = value
+		} else {
+			data.Args = append(data.Args, value)
+		}
+	}
+	if hasInner {
+		processed, err := r.process(strings.TrimSpace(inner))
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		pctx := parser.NewContext(parser.WithIDs(r.ids))
+		err = r.markdown.Convert([]byte(processed), &buf, parser.WithContext(pctx))
+		if err != nil {
+			return "", fmt.Errorf("shortcode %s: %v", name, err)
+		}
+		references, _ := pctx.Get(referencesContextKey).([]string)
+		r.references = append(r.references, references...)
+		headings, _ := pctx.Get(headingsContextKey).([]*TOCEntry)
+		r.headings = append(r.headings, headings...)
+		decisions, _ := pctx.Get(decisionsContextKey).([]Decision)
+		r.decisions = append(r.decisions, decisions...)
+		data.Inner = template.HTML(r.replace(buf.String()))
+	}
+	var buf bytes.Buffer
+	err := shortcode.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("shortcode %s: %v", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// replace swaps the rendered shortcodes back in for the placeholders in the HTML; a shortcode on its
+// own line is rendered as its own block instead of being wrapped in a paragraph. Escaped shortcodes
+// are put back as text.
+func (r *shortcodeRenderer) replace(html string) string {
+	for i := range r.rendered {
+		placeholder := r.placeholder(i)
+		html = strings.Replace(html, "<p>"+placeholder+"</p>", r.rendered[i], 1)
+		html = strings.Replace(html, placeholder, r.rendered[i], 1)
+	}
+	for i := range r.escaped {
+		html = strings.ReplaceAll(html, fmt.Sprintf("d2tositeescaped%dx", i), template.HTMLEscapeString(r.escaped[i]))
+	}
+	return html
+}
+
+// collect adds the headings and decisions of the inner content to the page's, in the order they are
+// on the page; the inner content is converted on its own, and a shortcode may not show it at all, so
+// they are placed by where their IDs are in the HTML and left out if they aren't there
+func (r *shortcodeRenderer) collect(html string, headings []*TOCEntry, decisions []Decision) ([]*TOCEntry, []Decision) {
+	position := func(id string) int {
+		return strings.Index(html, ` id="`+string(util.EscapeHTML([]byte(id)))+`"`)
+	}
+	allHeadings := []*TOCEntry{}
+	for _, heading := range append(headings, r.headings...) {
+		if position(heading.ID) != -1 {
+			allHeadings = append(allHeadings, heading)
+		}
+	}
+	sort.SliceStable(allHeadings, func(i, j int) bool {
+		return position(allHeadings[i].ID) < position(allHeadings[j].ID)
+	})
+	allDecisions := []Decision{}
+	for _, decision := range append(decisions, r.decisions...) {
+		if position(decision.ID) != -1 {
+			allDecisions = append(allDecisions, decision)
+		}
+	}
+	sort.SliceStable(allDecisions, func(i, j int) bool {
+		return position(allDecisions[i].ID) < position(allDecisions[j].ID)
+	})
+	return allHeadings, allDecisions
+}
@@ -0,0 +1,175 @@
+package parser_test
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestShortcodes(t *testing.T) {
+	shortcodes := map[string]*template.Template{
+		"callout": template.Must(template.New("callout").Funcs(parse.ShortcodeFuncs).Parse(`<div class="callout callout-{{.Get "type"}}">{{.Inner}}</div>`)),
+		"card":    template.Must(template.New("card").Funcs(parse.ShortcodeFuncs).Parse(`<span class="card">{{.Arg 0}} owned by {{.Get "owner"}}</span>`)),
+		"legend":  template.Must(template.New("legend").Funcs(parse.ShortcodeFuncs).Parse(`<figure>{{diagram (.Arg 0)}}<figcaption>{{.Get "caption"}}</figcaption></figure>`)),
+		"owner":   template.Must(template.New("owner").Funcs(parse.ShortcodeFuncs).Parse(`{{with index .Data.owners (.Arg 0)}}<span class="owner">{{.team}}</span>{{end}}`)),
+	}
+	options := &parse.MarkdownOptions{
+		Shortcodes: shortcodes,
+		Data: map[string]interface{}{
+			"owners": map[string]interface{}{
+				"billing": map[string]interface{}{"team": "payments"},
+			},
+		},
+	}
+
+	tests := []struct {
+		Input            string
+		ExpectedContains []string
+		ExpectedDiagrams []string
+		ExpectedError    string
+	}{
+		{
+			Input: "# Page\n\n{{< callout type=warning >}}\nBe **careful** with [[Billing]]\n{{< /callout >}}\n",
+			ExpectedContains: []string{
+				`<div class="callout callout-warning"><p>Be <strong>careful</strong> with <a href="#" class="wiki-link" data-wiki-link="Billing">Billing</a></p>`,
+			},
+		},
+		{
+			Input:            "# Page\n\nThe {{< card \"Billing API\" owner=payments />}} service\n",
+			ExpectedContains: []string{`<p>The <span class="card">Billing API owned by payments</span> service</p>`},
+		},
+		{
+			Input:            "# Page\n\n{{< legend sample caption=\"The <flow>\" >}}\n",
+			ExpectedContains: []string{`<figure><img src='/sample.svg' class='diagram-svg' alt='diagram' /><figcaption>The &lt;flow&gt;</figcaption></figure>`},
+			ExpectedDiagrams: []string{"/sample.svg"},
+		},
+		{
+			Input:            "# Page\n\n{{< callout type=outer >}}\nOuter\n\n{{< callout type=inner >}}\nInner\n{{< /callout >}}\n{{< /callout >}}\n",
+			ExpectedContains: []string{`<div class="callout callout-outer"><p>Outer</p>`, `<div class="callout callout-inner"><p>Inner</p>`},
+		},
+		{
+			Input:            "# Page\n\n`{{</* card */>}}`\n",
+			ExpectedContains: []string{`<code>{{&lt; card &gt;}}</code>`},
+		},
+		{
+			Input:            "# Page\n\n```\n{{< missing >}}\n{{< card \"Billing API\" />}}\n```\n\n{{< callout type=note >}}\n~~~\n{{< /callout >}}\n~~~\n{{< /callout >}}\n",
+			ExpectedContains: []string{"{{&lt; missing &gt;}}\n{{&lt; card &#34;Billing API&#34; /&gt;}}", `<div class="callout callout-note"><pre`, "{{&lt; /callout &gt;}}"},
+		},
+		{
+			Input:            "# Page\n\nBilling is owned by {{< owner billing />}}\n",
+			ExpectedContains: []string{`<p>Billing is owned by <span class="owner">payments</span></p>`},
+		},
+		{
+			Input:         "# Page\n\n{{< missing >}}\n",
+			ExpectedError: "shortcode missing is not defined",
+		},
+		{
+			Input:         "# Page\n\n{{< /callout >}}\n",
+			ExpectedError: "shortcode callout is closed without being opened",
+		},
+	}
+
+	for i := range tests {
+		leaf, err := parse.ParseMD([]byte(tests[i].Input), "/", options)
+		if tests[i].ExpectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), tests[i].ExpectedError) {
+				t.Errorf("test %d: expected an error containing '%s' but found %v", i, tests[i].ExpectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		content := string(leaf.Content)
+		for _, expected := range tests[i].ExpectedContains {
+			if !strings.Contains(content, expected) {
+				t.Errorf("test %d: expected the content to contain %s but found %s", i, expected, content)
+			}
+		}
+		if strings.Contains(content, "d2tosite") {
+			t.Errorf("test %d: expected every placeholder to be replaced but found %s", i, content)
+		}
+		if strings.Join(leaf.Diagrams, ",") != strings.Join(tests[i].ExpectedDiagrams, ",") {
+			t.Errorf("test %d: expected the diagrams %v but found %v", i, tests[i].ExpectedDiagrams, leaf.Diagrams)
+		}
+	}
+
+	// without any shortcodes, they are left alone
+	leaf, err := parse.ParseMD([]byte("# Page\n\n{{< card >}}\n"), "/", nil)
+	if err != nil || !strings.Contains(string(leaf.Content), "{{&lt; card &gt;}}") {
+		t.Errorf("expected the shortcode to be left alone: %v %v", err, leaf)
+	}
+}
+
+func TestShortcodesInnerHeadings(t *testing.T) {
+	options := &parse.MarkdownOptions{
+		Shortcodes: map[string]*template.Template{
+			"callout": template.Must(template.New("callout").Parse(`<div class="callout">{{.Inner}}</div>`)),
+			"card":    template.Must(template.New("card").Parse(`<span class="card">{{.Arg 0}}</span>`)),
+		},
+	}
+	input := "# Page\n\n## Before\n\n{{< callout >}}\n## Inside\n\n> [!DECISION] Use Postgres\n> We need transactions.\n{{< /callout >}}\n\n" +
+		"## After\n\n:::decision Keep the API\nVersioned.\n:::\n\n{{< card Billing >}}\n## Hidden\n{{< /card >}}\n"
+	leaf, err := parse.ParseMD([]byte(input), "/", options)
+	if err != nil {
+		t.Fatalf("could not parse the page: %v", err)
+	}
+
+	// the headings and decisions of the inner content are indexed where they are on the page, and
+	// left out when the shortcode doesn't show its inner content
+	titles := []string{}
+	for _, entry := range leaf.TOC {
+		titles = append(titles, entry.Title)
+	}
+	if strings.Join(titles, ",") != "Before,Inside,After" {
+		t.Errorf("expected the inner heading in the table of contents but found %v", titles)
+	}
+	if strings.Join(leaf.Anchors, ",") != "page,before,inside,after" {
+		t.Errorf("expected the inner heading to be an anchor but found %v", leaf.Anchors)
+	}
+	decisions := []string{}
+	for _, decision := range leaf.Decisions {
+		decisions = append(decisions, decision.ID)
+	}
+	if strings.Join(decisions, ",") != "decision-use-postgres,decision-keep-the-api" {
+		t.Errorf("expected the inner decision in order but found %v", decisions)
+	}
+}
+
+func TestLoadShortcodes(t *testing.T) {
+	directory := t.TempDir()
+	err := os.WriteFile(filepath.Join(directory, "card.html"), []byte(`<span>{{.Arg 0}}</span>`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(directory, "notes.txt"), []byte(`not a shortcode`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shortcodes, err := parse.LoadShortcodes(directory)
+	if err != nil {
+		t.Fatalf("could not load the shortcodes: %v", err)
+	}
+	if len(shortcodes) != 1 || shortcodes["card"] == nil {
+		t.Errorf("expected just the card shortcode but found %v", shortcodes)
+	}
+
+	shortcodes, err = parse.LoadShortcodes(filepath.Join(directory, "missing"))
+	if err != nil || len(shortcodes) != 0 {
+		t.Errorf("expected a missing directory to have no shortcodes: %v %v", err, shortcodes)
+	}
+
+	err = os.WriteFile(filepath.Join(directory, "broken.html"), []byte(`{{.Arg 0`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parse.LoadShortcodes(directory)
+	if err == nil || !strings.Contains(err.Error(), "shortcode broken") {
+		t.Errorf("expected an error for the broken shortcode but found %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// these regexes are used to find the pieces of a rendered SVG that must be namespaced
+// before it can live inside of an HTML page alongside other diagrams
+var svgHeaderRegex = regexp.MustCompile(`^\s*<\?xml[^>]*\?>\s*`)
+var svgRootRegex = regexp.MustCompile(`^<svg\b`)
+var svgIDRegex = regexp.MustCompile(`\bid="([^"]*)"`)
+var svgURLRefRegex = regexp.MustCompile(`url\(#([^)]*)\)`)
+var svgHrefRefRegex = regexp.MustCompile(`\b((?:xlink:)?href)="#([^"]*)"`)
+var svgStyleRegex = regexp.MustCompile(`(?s)<style type="text/css">(.*?)</style>`)
+var cssCommentRegex = regexp.MustCompile(`(?s)/\*.*?\*/`)
+var fontFamilyRegex = regexp.MustCompile(`font-family:\s*"?([\w-]+)"?`)
+
+// SVGInliner rewrites rendered diagrams so that several of them can be inlined into the same
+// HTML page. Each diagram gets its own namespace for element IDs and styles, and the embedded
+// fonts are only emitted the first time they are seen. A new inliner should be used for each page.
+type SVGInliner struct {
+	count int
+	fonts map[string]bool
+}
+
+// NewSVGInliner creates a new inliner for a single page
+func NewSVGInliner() *SVGInliner {
+	return &SVGInliner{
+		fonts: map[string]bool{},
+	}
+}
+
+// Inline takes a rendered SVG and returns markup that is safe to place directly in the page
+func (inliner *SVGInliner) Inline(svg []byte) []byte {
+	inliner.count++
+	namespace := fmt.Sprintf("d2-svg-%d", inliner.count)
+
+	output := svgHeaderRegex.ReplaceAllString(string(svg), "")
+
+	// the styles are handled first so the selectors aren't caught by the ID rewriting
+	output = svgStyleRegex.ReplaceAllStringFunc(output, func(block string) string {
+		css := svgStyleRegex.FindStringSubmatch(block)[1]
+		css = strings.TrimSpace(css)
+		css = strings.TrimPrefix(css, "<![CDATA[")
+		css = strings.TrimSuffix(css, "]]>")
+		scoped := inliner.scopeCSS(css, "#"+namespace)
+		if strings.TrimSpace(scoped) == "" {
+			return ""
+		}
+		return fmt.Sprintf(`<style type="text/css"><![CDATA[%s]]></style>`, scoped)
+	})
+
+	output = svgIDRegex.ReplaceAllString(output, fmt.Sprintf(`id="%s-$1"`, namespace))
+	output = svgURLRefRegex.ReplaceAllString(output, fmt.Sprintf(`url(#%s-$1)`, namespace))
+	output = svgHrefRefRegex.ReplaceAllString(output, fmt.Sprintf(`$1="#%s-$2"`, namespace))
+	output = svgRootRegex.ReplaceAllString(output, fmt.Sprintf(`<svg id="%s" class="diagram-svg diagram-inline"`, namespace))
+	return []byte(output)
+}
+
+// scopeCSS prefixes every selector in the CSS with the scope; @font-face rules are global,
+// so those are kept as is but only the first rule for each family is kept for the page
+func (inliner *SVGInliner) scopeCSS(css, scope string) string {
+	css = cssCommentRegex.ReplaceAllString(css, "")
+	var builder strings.Builder
+	for {
+		open := strings.Index(css, "{")
+		if open == -1 {
+			break
+		}
+		end := strings.Index(css[open:], "}")
+		if end == -1 {
+			break
+		}
+		end += open
+		selector := strings.TrimSpace(css[:open])
+		body := css[open+1 : end]
+		css = css[end+1:]
+
+		if strings.HasPrefix(selector, "@font-face") {
+			family := ""
+			if found := fontFamilyRegex.FindStringSubmatch(body); len(found) > 1 {
+				family = found[1]
+			}
+			if inliner.fonts[family] {
+				continue
+			}
+			inliner.fonts[family] = true
+			builder.WriteString(fmt.Sprintf("\n%s {%s}", selector, body))
+			continue
+		}
+
+		selectors := strings.Split(selector, ",")
+		for i := range selectors {
+			selectors[i] = scope + " " + strings.TrimSpace(selectors[i])
+		}
+		builder.WriteString(fmt.Sprintf("\n%s {%s}", strings.Join(selectors, ",\n"), body))
+	}
+	return builder.String()
+}
@@ -0,0 +1,53 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestSVGInliner(t *testing.T) {
+	svg, err := parse.ParseD2([]byte("a -> b\na.tooltip: Hello\nb.link: https://example.com"), nil)
+	if err != nil {
+		t.Fatalf("could not parse the diagram: %v", err)
+	}
+	if !strings.Contains(string(svg), "<title>Hello</title>") {
+		t.Errorf("expected the tooltip to be rendered as a title")
+	}
+	if !strings.Contains(string(svg), `<a href="https://example.com" target="_top"><g id="b">`) {
+		t.Errorf("expected the link to wrap the shape")
+	}
+
+	inliner := parse.NewSVGInliner()
+	first := string(inliner.Inline(svg))
+	second := string(inliner.Inline(svg))
+
+	if strings.Contains(first, "<?xml") {
+		t.Errorf("expected the xml header to be removed")
+	}
+	if !strings.HasPrefix(first, `<svg id="d2-svg-1" class="diagram-svg diagram-inline"`) {
+		t.Errorf("expected the first svg to be namespaced, found %s", first[:100])
+	}
+	if !strings.HasPrefix(second, `<svg id="d2-svg-2" class="diagram-svg diagram-inline"`) {
+		t.Errorf("expected the second svg to be namespaced, found %s", second[:100])
+	}
+	if !strings.Contains(first, `<g id="d2-svg-1-a">`) || !strings.Contains(second, `<g id="d2-svg-2-a">`) {
+		t.Errorf("expected the shape IDs to be namespaced")
+	}
+	if strings.Contains(second, `url(#d2-svg-1-`) {
+		t.Errorf("expected the second svg to only reference its own IDs")
+	}
+	if !strings.Contains(first, "#d2-svg-1 .shape") {
+		t.Errorf("expected the styles to be scoped to the svg")
+	}
+	if !strings.Contains(first, "@font-face") {
+		t.Errorf("expected the first svg to carry the fonts")
+	}
+	if strings.Contains(second, "@font-face") {
+		t.Errorf("expected the fonts to only be embedded once per page")
+	}
+	if len(second) >= len(first) {
+		t.Errorf("expected the second svg to be smaller than the first without fonts")
+	}
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// svgTagRegex finds the root element of an SVG, along with its attributes
+var svgTagRegex = regexp.MustCompile(`(?s)<svg\b([^>]*)>`)
+
+// svgAttributeRegex finds a single attribute on the root element
+var svgAttributeRegex = regexp.MustCompile(`(?s)\b(width|height|viewBox)\s*=\s*["']([^"']*)["']`)
+
+// svgLengthRegex splits a length, such as 120pt or 861, into the number and the unit
+var svgLengthRegex = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+)\s*(px|pt|)\s*$`)
+
+// DiagramSize is the intrinsic size of a rendered diagram, in CSS pixels
+type DiagramSize struct {
+	Width  int
+	Height int
+}
+
+// String formats the size for display, such as 861 × 978
+func (size DiagramSize) String() string {
+	return fmt.Sprintf("%d × %d", size.Width, size.Height)
+}
+
+// SVGSize reads the intrinsic size of a rendered SVG from the width and height of its root element,
+// falling back to the viewBox when they are missing or relative, such as 100%. D2 sets all three,
+// and the viewBox includes the padding around the diagram's bounding box.
+func SVGSize(svg []byte) (DiagramSize, bool) {
+	root := svgTagRegex.FindSubmatch(svg)
+	if len(root) == 0 {
+		return DiagramSize{}, false
+	}
+	attributes := map[string]string{}
+	for _, found := range svgAttributeRegex.FindAllSubmatch(root[1], -1) {
+		attributes[string(found[1])] = string(found[2])
+	}
+	width, widthFound := svgLength(attributes["width"])
+	height, heightFound := svgLength(attributes["height"])
+	if !widthFound || !heightFound {
+		box := strings.Fields(strings.ReplaceAll(attributes["viewBox"], ",", " "))
+		if len(box) != 4 {
+			return DiagramSize{}, false
+		}
+		var err error
+		width, err = strconv.ParseFloat(box[2], 64)
+		if err != nil {
+			return DiagramSize{}, false
+		}
+		height, err = strconv.ParseFloat(box[3], 64)
+		if err != nil {
+			return DiagramSize{}, false
+		}
+	}
+	if width <= 0 || height <= 0 {
+		return DiagramSize{}, false
+	}
+	return DiagramSize{
+		Width:  int(math.Round(width)),
+		Height: int(math.Round(height)),
+	}, true
+}
+
+// svgLength converts an absolute length to pixels; points, which Graphviz uses, are 4/3 of a pixel
+func svgLength(value string) (float64, bool) {
+	found := svgLengthRegex.FindStringSubmatch(value)
+	if len(found) == 0 {
+		return 0, false
+	}
+	length, err := strconv.ParseFloat(found[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	if found[2] == "pt" {
+		length = length * 4 / 3
+	}
+	return length, true
+}
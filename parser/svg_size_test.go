@@ -0,0 +1,55 @@
+package parser_test
+
+import (
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestSVGSize(t *testing.T) {
+	rendered, err := parse.ParseD2([]byte("a -> b"), nil)
+	if err != nil {
+		t.Fatalf("could not parse the diagram: %v", err)
+	}
+	size, found := parse.SVGSize(rendered)
+	if !found || size.Width <= 0 || size.Height <= size.Width {
+		t.Errorf("expected the size of a vertical D2 diagram but found %+v", size)
+	}
+
+	tests := []struct {
+		SVG      string
+		Expected parse.DiagramSize
+		Found    bool
+	}{
+		{
+			SVG:      `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="861" height="978" viewBox="-100 -100 861 978">`,
+			Expected: parse.DiagramSize{Width: 861, Height: 978},
+			Found:    true,
+		},
+		{
+			SVG:      `<svg width="62pt" height="116pt" viewBox="0.00 0.00 62.00 116.00">`,
+			Expected: parse.DiagramSize{Width: 83, Height: 155},
+			Found:    true,
+		},
+		{
+			SVG:      `<svg width="100%" height="100%" viewBox="0,0,400,200">`,
+			Expected: parse.DiagramSize{Width: 400, Height: 200},
+			Found:    true,
+		},
+		{
+			SVG: `<svg xmlns="http://www.w3.org/2000/svg">`,
+		},
+		{
+			SVG: `<p>not a diagram</p>`,
+		},
+	}
+	for i := range tests {
+		size, found := parse.SVGSize([]byte(tests[i].SVG))
+		if found != tests[i].Found || size != tests[i].Expected {
+			t.Errorf("test %d: expected %+v %t but found %+v %t", i, tests[i].Expected, tests[i].Found, size, found)
+		}
+	}
+	if (parse.DiagramSize{Width: 861, Height: 978}).String() != "861 × 978" {
+		t.Errorf("expected the size to be formatted for display")
+	}
+}
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// TOCEntry is a single heading in the table of contents, with any headings below it as children
+type TOCEntry struct {
+	Level    int
+	ID       string
+	Title    string
+	Children []*TOCEntry
+}
+
+// headingsContextKey is used to pass the headings found by the transformer back to ParseMD
+var headingsContextKey = parser.NewContextKey()
+
+// headingIDs generates the IDs for the headings; unlike the default goldmark IDs, letters outside
+// of ASCII are kept so headings in other languages still have readable IDs
+type headingIDs struct {
+	values map[string]bool
+}
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{
+		values: map[string]bool{},
+	}
+}
+
+// Generate creates a new unique ID for the value
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	id := Slugify(string(value))
+	if id == "" {
+		id = "heading"
+		if kind != ast.KindHeading {
+			id = "id"
+		}
+	}
+	if !ids.values[id] {
+		ids.values[id] = true
+		return []byte(id)
+	}
+	for i := 1; ; i++ {
+		next := fmt.Sprintf("%s-%d", id, i)
+		if !ids.values[next] {
+			ids.values[next] = true
+			return []byte(next)
+		}
+	}
+}
+
+// Put records an ID that was set by hand so it isn't generated again
+func (ids *headingIDs) Put(value []byte) {
+	ids.values[string(value)] = true
+}
+
+// Slugify lowercases the value and keeps only letters and numbers, joining everything else with a dash
+func Slugify(value string) string {
+	var builder strings.Builder
+	dash := false
+	for _, r := range strings.TrimSpace(value) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if dash && builder.Len() > 0 {
+				builder.WriteRune('-')
+			}
+			dash = false
+			builder.WriteRune(unicode.ToLower(r))
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			dash = true
+		}
+	}
+	return builder.String()
+}
+
+// headingTransformer collects the headings once they have IDs and adds a permalink anchor to
+// each one below the page title
+type headingTransformer struct{}
+
+// Transform implements the goldmark ASTTransformer
+func (transformer *headingTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	headings := []*TOCEntry{}
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		id := ""
+		if value, found := heading.AttributeString("id"); found {
+			if converted, cOK := value.([]byte); cOK {
+				id = string(converted)
+			}
+		}
+		headings = append(headings, &TOCEntry{
+			Level: heading.Level,
+			ID:    id,
+			Title: strings.TrimSpace(string(heading.Text(reader.Source()))),
+		})
+		if id != "" && heading.Level > 1 {
+			anchor := ast.NewLink()
+			anchor.Destination = []byte("#" + id)
+			anchor.SetAttributeString("class", []byte("heading-anchor"))
+			anchor.SetAttributeString("title", []byte("Permalink"))
+			anchor.AppendChild(anchor, ast.NewString([]byte("#")))
+			heading.AppendChild(heading, anchor)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	pc.Set(headingsContextKey, headings)
+}
+
+// BuildTOC nests the headings between the min and max levels into a table of contents
+func BuildTOC(headings []*TOCEntry, minLevel, maxLevel int) []*TOCEntry {
+	toc := []*TOCEntry{}
+	stack := []*TOCEntry{}
+	for _, heading := range headings {
+		if heading.Level < minLevel || heading.Level > maxLevel || heading.ID == "" {
+			continue
+		}
+		entry := &TOCEntry{
+			Level:    heading.Level,
+			ID:       heading.ID,
+			Title:    heading.Title,
+			Children: []*TOCEntry{},
+		}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= entry.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc = append(toc, entry)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+		stack = append(stack, entry)
+	}
+	return toc
+}
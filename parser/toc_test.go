@@ -0,0 +1,87 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	parse "github.com/kevineaton/d2tosite/parser"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Hello World":           "hello-world",
+		"  Trim me  ":           "trim-me",
+		"API: v2 (beta)!":       "api-v2-beta",
+		"snake_case and-dash":   "snake-case-and-dash",
+		"Übersicht der Dienste": "übersicht-der-dienste",
+		"!!!":                   "",
+	}
+	for input, expected := range tests {
+		if found := parse.Slugify(input); found != expected {
+			t.Errorf("expected '%s' to become '%s' but found '%s'", input, expected, found)
+		}
+	}
+}
+
+func TestTableOfContents(t *testing.T) {
+	input := []byte("# Title\n\n## Overview\n\n### Details\n\n#### Deep\n\n##### Too Deep\n\n## Overview\n\n## Next Steps\n")
+	output, err := parse.ParseMD(input, "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content := string(output.Content)
+	if !strings.Contains(content, `<h2 id="overview">Overview<a href="#overview" class="heading-anchor" title="Permalink">#</a></h2>`) {
+		t.Errorf("expected the heading to have an id and a permalink: %s", content)
+	}
+	if !strings.Contains(content, `<h2 id="overview-1">`) {
+		t.Errorf("expected the duplicate heading to get a unique id: %s", content)
+	}
+	if strings.Contains(content, `href="#title"`) {
+		t.Errorf("expected the page title to not have a permalink")
+	}
+
+	if len(output.TOC) != 3 {
+		t.Fatalf("expected 3 top level entries but found %d", len(output.TOC))
+	}
+	if output.TOC[0].ID != "overview" || len(output.TOC[0].Children) != 1 {
+		t.Fatalf("expected the first entry to be nested: %+v", output.TOC[0])
+	}
+	details := output.TOC[0].Children[0]
+	if details.Title != "Details" || len(details.Children) != 1 || details.Children[0].Title != "Deep" {
+		t.Errorf("expected the details to hold the deep heading: %+v", details)
+	}
+	if len(details.Children[0].Children) != 0 {
+		t.Errorf("expected headings below the max level to be left out")
+	}
+	if output.TOC[1].ID != "overview-1" || output.TOC[2].ID != "next-steps" {
+		t.Errorf("expected the remaining entries in order")
+	}
+
+	// the levels can be changed
+	output, err = parse.ParseMD(input, "/", &parse.MarkdownOptions{TOCMinLevel: 1, TOCMaxLevel: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(output.TOC) != 1 || output.TOC[0].ID != "title" || len(output.TOC[0].Children) != 3 {
+		t.Errorf("expected the title to hold the second level headings: %+v", output.TOC)
+	}
+
+	// the defaults aren't written back to options shared between pages
+	shared := &parse.MarkdownOptions{TOCMaxLevel: 2}
+	_, err = parse.ParseMD(input, "/", shared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shared.TOCMinLevel != 0 || shared.TOCMaxLevel != 2 {
+		t.Errorf("expected the options to be left as they were given: %+v", shared)
+	}
+
+	// and turned off per page
+	output, err = parse.ParseMD(append([]byte("---\ntoc: false\n---\n"), input...), "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(output.TOC) != 0 {
+		t.Errorf("expected no table of contents but found %d entries", len(output.TOC))
+	}
+}